@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Exit statuses when the process is stopped before it finishes. Interrupts get the
+// status a shell reports for the signal, and timeouts the same status as timeout(1)
+const (
+	exitCodeTimeout   = 124
+	exitCodeHangup    = 129
+	exitCodeInterrupt = 130
+	exitCodeTerminate = 143
+)
+
+// abortGrace is how long past -timeout calls that take the context get to return on
+// their own, before the process exits from under prompts and YubiKey touches that don't
+const abortGrace = time.Second
+
+// resolveTimeout limits how long resolving credentials may take, set with -timeout
+var resolveTimeout time.Duration
+
+var (
+	abortMu       sync.Mutex
+	abortNextID   int
+	abortCleanups = map[int]func(){}
+	// signalForward is passed SIGTERM and SIGHUP in place of exiting, if set
+	signalForward func(os.Signal)
+)
+
+// onAbort registers fn to release a resource, like a TTY in raw mode or a smart card
+// handle, if the process is interrupted or times out while holding it. The returned
+// func unregisters it, and is deferred alongside the normal release
+func onAbort(fn func()) func() {
+	abortMu.Lock()
+	defer abortMu.Unlock()
+	abortNextID++
+	id := abortNextID
+	abortCleanups[id] = fn
+	return func() {
+		abortMu.Lock()
+		defer abortMu.Unlock()
+		delete(abortCleanups, id)
+	}
+}
+
+// abort releases the registered resources and exits. The lock is held until the
+// process exits, so nothing else is registered or released meanwhile
+func abort(code int, reason string) {
+	abortMu.Lock()
+	for _, fn := range abortCleanups {
+		fn()
+	}
+	log.Print(reason)
+	os.Exit(code)
+}
+
+// forwardSignals has SIGTERM and SIGHUP passed to fn rather than exit the process, e.g.
+// to stop a child first and clean up once it exits. The returned func stops forwarding
+func forwardSignals(fn func(os.Signal)) func() {
+	abortMu.Lock()
+	defer abortMu.Unlock()
+	signalForward = fn
+	return func() {
+		abortMu.Lock()
+		defer abortMu.Unlock()
+		signalForward = nil
+	}
+}
+
+// handleSignals exits on SIGINT, SIGTERM or SIGHUP, after releasing the registered
+// resources so the terminal isn't left without echo and the YubiKey isn't left claimed
+func handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			abortMu.Lock()
+			forward := signalForward
+			abortMu.Unlock()
+			if forward != nil && sig != os.Interrupt {
+				forward(sig)
+				continue
+			}
+
+			code := exitCodeInterrupt
+			switch sig {
+			case syscall.SIGTERM:
+				code = exitCodeTerminate
+			case syscall.SIGHUP:
+				code = exitCodeHangup
+			}
+			abort(code, fmt.Sprintf("stopped by %s", sig))
+		}
+	}()
+}
+
+// timeoutError is returned when credentials are not resolved within -timeout
+type timeoutError struct {
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("timed out resolving credentials after %s", e.timeout)
+}
+
+// withResolveTimeout returns a context carrying the -timeout deadline, if there is one.
+// Prompts and YubiKey touches don't take a context, so a watchdog exits the process if
+// they are still waiting shortly after the deadline. The returned func stops it
+func withResolveTimeout(ctx context.Context) (context.Context, func()) {
+	if resolveTimeout <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	watchdog := time.AfterFunc(resolveTimeout+abortGrace, func() {
+		abort(exitCodeTimeout, (&timeoutError{resolveTimeout}).Error())
+	})
+	return ctx, func() {
+		watchdog.Stop()
+		cancel()
+	}
+}
@@ -0,0 +1,198 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/ryandeivert/aws-cred-proc/pkg/output"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "assume-all",
+		usage: "assume the same role in many accounts at once with the profile's credentials, e.g. for audits and fleet scripts, printing the credentials of each account as JSON or suffixed environment variables. The accounts are given with -accounts or listed from AWS Organizations with -org",
+		run:   runAssumeAll,
+	})
+}
+
+// Formats of assume-all -format
+const (
+	assumeAllJSON = "json"
+	assumeAllEnv  = "env"
+)
+
+var accountIDPattern = regexp.MustCompile(`^\d{12}$`)
+
+// assumeAllError is printed in place of the credentials of an account the role could
+// not be assumed in
+type assumeAllError struct {
+	Error string
+}
+
+func runAssumeAll(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageRoleName = "the `name` of the role to assume in each account"
+		usageAccounts = "comma separated `ids` of the accounts to assume the role in"
+		usageOrg      = "assume the role in every active account of the AWS Organization, listed with the profile's credentials (which need organizations:ListAccounts)"
+		usageParallel = "how many accounts to assume the role in at once"
+		usageFormat   = "the `format` to print: json, an object of credential_process credentials by account id, or env, exports suffixed with the account id"
+	)
+	var roleName, accountList, format string
+	var org bool
+	var parallel int
+
+	addCredentialFlags(fs)
+	fs.StringVar(&roleName, "role-name", "", usageRoleName)
+	fs.StringVar(&accountList, "accounts", "", usageAccounts)
+	fs.BoolVar(&org, "org", false, usageOrg)
+	fs.IntVar(&parallel, "parallel", 8, usageParallel)
+	fs.StringVar(&format, "format", assumeAllJSON, usageFormat)
+	fs.Parse(args)
+
+	if roleName == "" {
+		return fmt.Errorf("assume-all requires -role-name")
+	}
+	if (accountList == "") == !org {
+		return fmt.Errorf("assume-all requires one of -accounts or -org")
+	}
+	if format != assumeAllJSON && format != assumeAllEnv {
+		return fmt.Errorf("invalid -format %q, expected %s or %s", format, assumeAllJSON, assumeAllEnv)
+	}
+	if parallel < 1 {
+		return fmt.Errorf("-parallel must be at least 1")
+	}
+	var accounts []string
+	for _, id := range strings.Split(accountList, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		if !accountIDPattern.MatchString(id) {
+			return fmt.Errorf("invalid account id %q in -accounts", id)
+		}
+		accounts = append(accounts, id)
+	}
+
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+	creds, err := src.load(ctx)
+	if err != nil {
+		return err
+	}
+	if org {
+		orgAccounts, err := listOrgAccounts(ctx, creds, src.region)
+		if err != nil {
+			return err
+		}
+		for _, account := range orgAccounts {
+			accounts = append(accounts, account.Id)
+		}
+	}
+	sort.Strings(accounts)
+
+	client := accountRoleClient(creds, src.region)
+	partition := regionPartition(src.region)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := map[string]aws.Credentials{}
+	failures := map[string]error{}
+	slots := make(chan struct{}, parallel)
+	for _, account := range accounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			roleArn := fmt.Sprintf("arn:%s:iam::%s:role/%s", partition, account, roleName)
+			creds, err := assumeInAccount(ctx, client, roleArn)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Printf("warning: failed to assume %s, %v", roleArn, err)
+				failures[account] = err
+				return
+			}
+			creds.AccountID = account
+			results[account] = creds
+		}()
+	}
+	wg.Wait()
+
+	if format == assumeAllEnv {
+		for _, account := range accounts {
+			if creds, ok := results[account]; ok {
+				fmt.Printf("# %s\n%s\n", account, output.NewShellCredentials(creds, src.region).Lines(func(name, value string) string {
+					return fmt.Sprintf("export %s_%s=%s", name, account, value)
+				}))
+			}
+		}
+	} else {
+		out := map[string]any{}
+		for account, creds := range results {
+			out[account] = output.NewProcessCredentials(creds)
+		}
+		for account, err := range failures {
+			out[account] = assumeAllError{err.Error()}
+		}
+		if err := writeToStdOut(out); err != nil {
+			return err
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to assume %s in %d of %d accounts", roleName, len(failures), len(accounts))
+	}
+	fmt.Fprintf(os.Stderr, "Assumed %s in %d accounts\n", roleName, len(accounts))
+	return nil
+}
+
+// accountRoleClient assumes roles in other accounts with the credentials
+func accountRoleClient(creds aws.Credentials, region string) *assumeRoleClient {
+	return &assumeRoleClient{
+		AssumeRoleAPIClient: sts.New(sts.Options{
+			Credentials: credentials.StaticCredentialsProvider{Value: creds},
+			Region:      region,
+		}, withSTSOptions),
+		omitDuration: duration == 0,
+	}
+}
+
+// assumeInAccount assumes the role with the client's credentials, through the cache
+// unless it's disabled. The role options are the same as for the profile's own role
+func assumeInAccount(ctx context.Context, client stscreds.AssumeRoleAPIClient, roleArn string) (aws.Credentials, error) {
+	var opts stscreds.AssumeRoleOptions
+	provider := stscreds.NewAssumeRoleProvider(client, roleArn, func(o *stscreds.AssumeRoleOptions) {
+		if duration != 0 {
+			o.Duration = duration
+		}
+		if sessionNameTemplate != "" {
+			o.RoleSessionName = roleSessionName(sessionNameTemplate)
+		}
+		if sessionPolicyFile != "" {
+			// Checked when the credential source was set up
+			policy, _ := readSessionPolicy(sessionPolicyFile)
+			o.Policy = aws.String(policy)
+		}
+		opts = *o
+	})
+	if noCache {
+		return provider.Retrieve(ctx)
+	}
+	return NewCache(provider, forceRefresh, dpapiCache, assumeRoleCacheKey(opts)).Load(ctx)
+}
@@ -0,0 +1,69 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// The characters STS allows in a session tag value
+var sessionTagValuePattern = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]{1,256}$`)
+
+// attestationToken runs the -attestation-cmd helper (e.g. one producing a TPM quote or a
+// Secure Enclave assertion) and returns the token it prints. The role being assumed and
+// the profile are passed in the environment, so the helper can bind the token to them
+func attestationToken(ctx context.Context, roleArn string) (string, error) {
+	args := strings.Fields(attestationCmd)
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(cmd.Environ(),
+		"AWS_CRED_PROC_ROLE_ARN="+roleArn,
+		"AWS_CRED_PROC_PROFILE="+profileOrDefault(),
+	)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("attestation command failed, %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("attestation command did not print a token")
+	}
+	return token, nil
+}
+
+// attest attaches an attestation token to the request, either as a session tag, which
+// requires sts:TagSession in the role's trust policy, or as a suffix of the SourceIdentity,
+// which requires sts:SetSourceIdentity. IAM policies can then require either for a role
+func attest(ctx context.Context, params *sts.AssumeRoleInput) error {
+	token, err := attestationToken(ctx, aws.ToString(params.RoleArn))
+	if err != nil {
+		return err
+	}
+
+	switch attestationAs {
+	case attestAsTag:
+		if !sessionTagValuePattern.MatchString(token) {
+			return fmt.Errorf("attestation token is not a valid session tag value")
+		}
+		params.Tags = append(params.Tags, types.Tag{Key: aws.String(attestationTagKey), Value: aws.String(token)})
+	case attestAsSourceIdentity:
+		identity := aws.ToString(params.SourceIdentity)
+		if identity == "" {
+			identity = currentUsername()
+		}
+		// SourceIdentity has the same limits as a role session name
+		params.SourceIdentity = aws.String(sanitizeRoleSessionName(identity + "+" + token))
+	}
+	return nil
+}
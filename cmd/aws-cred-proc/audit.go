@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// auditEvent is one line of the audit log, recording use of elevated credentials
+type auditEvent struct {
+	Time     time.Time
+	Action   string
+	Profile  string
+	RoleArn  string   `json:",omitempty"`
+	Command  []string `json:",omitempty"`
+	ExitCode *int     `json:",omitempty"`
+}
+
+func auditLogPath() string {
+	return filepath.Join(stateDir(), "audit.log")
+}
+
+// audit appends the event to the audit log as a line of JSON
+func audit(event auditEvent) error {
+	event.Time = time.Now().UTC()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event, %w", err)
+	}
+
+	if err := makeDirs(stateDir()); err != nil {
+		return fmt.Errorf("failed to make directories, %w", err)
+	}
+	f, err := os.OpenFile(auditLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, fileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log, %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log, %w", err)
+	}
+	return enforceFileMode(auditLogPath())
+}
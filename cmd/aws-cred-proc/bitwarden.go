@@ -0,0 +1,106 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ryandeivert/aws-cred-proc/pkg/mfa"
+)
+
+// Keyring account used to remember the session key from `bw unlock` between invocations
+const bitwardenSessionAccount = "bitwarden-session"
+
+// BitwardenCode reads the current TOTP code for an item using the Bitwarden CLI
+func BitwardenCode(item string) func() (string, error) {
+	return func() (string, error) {
+		session, err := bitwardenSession()
+		if err != nil {
+			return "", err
+		}
+		return mfa.RunCommand(bitwardenCommand(session, "get", "totp", item))
+	}
+}
+
+// bitwardenCommand runs bw with the session key in BW_SESSION, since with --session it
+// would show in the process list
+func bitwardenCommand(session string, args ...string) *exec.Cmd {
+	cmd := exec.Command("bw", args...)
+	if session != "" {
+		cmd.Env = append(unsetEnv(os.Environ(), "BW_SESSION"), "BW_SESSION="+session)
+	}
+	return cmd
+}
+
+// bitwardenStatus returns the vault status reported by `bw status`:
+// unauthenticated, locked or unlocked
+func bitwardenStatus(session string) (string, error) {
+	out, err := bitwardenCommand(session, "status").Output()
+	if err != nil {
+		return "", fmt.Errorf("bw status failed, %w", err)
+	}
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(out, &status); err != nil {
+		return "", fmt.Errorf("failed to decode bw status, %w", err)
+	}
+	return status.Status, nil
+}
+
+// bitwardenSession returns a session key for an unlocked vault, preferring BW_SESSION,
+// then a session key saved in the OS keyring, and finally unlocking the vault with
+// the master password. A new session key is saved so the next invocation won't prompt
+func bitwardenSession() (string, error) {
+	if session := os.Getenv("BW_SESSION"); session != "" {
+		return session, nil
+	}
+
+	session, err := keyringGet(bitwardenSessionAccount)
+	if err == nil {
+		if status, _ := bitwardenStatus(session); status == "unlocked" {
+			return session, nil
+		}
+	} else if !errors.Is(err, errKeyringNotFound) {
+		return "", err
+	}
+
+	status, err := bitwardenStatus("")
+	if err != nil {
+		return "", err
+	}
+	if status == "unauthenticated" {
+		return "", fmt.Errorf("bitwarden CLI is not logged in, run `bw login` first")
+	}
+
+	password, err := bitwardenPassword()
+	if err != nil {
+		return "", err
+	}
+
+	// Pass the password through the environment of the child only, never its arguments
+	cmd := exec.Command("bw", "unlock", "--raw", "--passwordenv", "AWS_CRED_PROC_BW_PASSWORD")
+	cmd.Env = append(os.Environ(), "AWS_CRED_PROC_BW_PASSWORD="+password)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("bw unlock failed, %w", err)
+	}
+
+	session = strings.TrimSpace(string(out))
+	if err := keyringSet(bitwardenSessionAccount, session); err != nil {
+		// Not fatal, the vault will just be unlocked again next time
+		log.Printf("warning: failed to save bitwarden session, %v", err)
+	}
+	return session, nil
+}
+
+func bitwardenPassword() (string, error) {
+	return promptPassword("aws-cred-proc:bitwarden", "Bitwarden Master Password:")
+}
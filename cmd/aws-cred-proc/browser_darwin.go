@@ -0,0 +1,10 @@
+//go:build !credproc_min
+
+package main
+
+import "os/exec"
+
+// openBrowser opens the URL with open
+func openBrowser(url string) error {
+	return exec.Command("open", url).Start()
+}
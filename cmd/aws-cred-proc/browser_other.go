@@ -0,0 +1,10 @@
+//go:build !darwin && !windows && !credproc_min
+
+package main
+
+import "os/exec"
+
+// openBrowser opens the URL with xdg-open
+func openBrowser(url string) error {
+	return exec.Command("xdg-open", url).Start()
+}
@@ -0,0 +1,11 @@
+//go:build !credproc_min
+
+package main
+
+import "os/exec"
+
+// openBrowser opens the URL with the handler registered for it. Unlike start, this
+// doesn't go through cmd.exe, which would interpret the & characters in the URL
+func openBrowser(url string) error {
+	return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+}
@@ -0,0 +1,311 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ryandeivert/aws-cred-proc/pkg/cache"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "cache",
+		usage: "work with cache entries. Subcommands: list (show each entry's profile, role and expiration), clear (remove the profile's entries, or every entry with -all), prune (remove expired entries), inspect <file or entry> (show the inputs an entry's name was computed from, to see why two invocations did not share a session)",
+		run:   runCache,
+	})
+}
+
+func runCache(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageAll     = "remove every entry in the cache, including those written by the aws CLI (clear only)"
+		usageShred   = "overwrite entries with random data before removing them (clear and prune, file backend only)"
+		usageBackend = "the -cache-backend whose entries to work with"
+	)
+	var all, shred bool
+
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("cache requires one of: list, clear, prune, inspect")
+	}
+	action := args[0]
+	if action == "clear" {
+		addCredentialFlags(fs)
+		fs.BoolVar(&all, "all", false, usageAll)
+	} else {
+		// The credential flags include it, and are only needed to clear a profile's entries
+		fs.StringVar(&cacheBackendName, "cache-backend", cacheBackendFile, usageBackend)
+	}
+	if action == "clear" || action == "prune" {
+		fs.BoolVar(&shred, "shred", false, usageShred)
+	}
+	fs.Parse(args[1:])
+
+	if err := applyFlagDefaults(fs); err != nil {
+		return err
+	}
+	backend, err := lookupCacheBackend(cacheBackendName)
+	if err != nil {
+		return err
+	}
+	cacheBackend = backend
+
+	switch action {
+	case "list":
+		return listCacheEntries()
+	case "clear":
+		return clearCacheEntries(ctx, all, shred)
+	case "prune":
+		return pruneCacheEntries(shred)
+	case "inspect":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("cache inspect requires the path of a cache file or the name of an entry")
+		}
+		return inspectCacheEntry(fs.Arg(0))
+	default:
+		return fmt.Errorf("unknown cache subcommand %q", action)
+	}
+}
+
+// cacheEntry is an entry in the -cache-backend
+type cacheEntry struct {
+	name string
+	key  string
+	item *cache.Item // nil if the entry could not be read
+}
+
+func (e *cacheEntry) expires() (time.Time, bool) {
+	if e.item == nil || e.item.Credentials == nil {
+		return time.Time{}, false
+	}
+	return time.Time(e.item.Credentials.Expiration), true
+}
+
+// cacheEntries returns the entries in the -cache-backend, both plaintext and encrypted
+func cacheEntries() ([]*cacheEntry, error) {
+	names, err := cacheBackend.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*cacheEntry
+	for _, name := range names {
+		encrypted := strings.HasSuffix(name, ".dpapi")
+		if !(encrypted || strings.HasSuffix(name, ".json")) {
+			continue
+		}
+		entry := &cacheEntry{
+			name: name,
+			key:  strings.Split(name, ".")[0],
+		}
+		if data, err := cacheBackend.Get(name); err == nil {
+			entry.item, _ = decodeCacheItem(data, encrypted)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// removeCacheEntry deletes the named entry from the -cache-backend, shredding it first if
+// requested and the backend supports it
+func removeCacheEntry(name string, shred bool) error {
+	remove := cacheBackend.Delete
+	if shredder, ok := cacheBackend.(cache.Shredder); ok && shred {
+		remove = shredder.Shred
+	}
+	if err := remove(name); err != nil {
+		return fmt.Errorf("failed to remove %s, %w", cacheBackend.Location(name), err)
+	}
+	return nil
+}
+
+func listCacheEntries() error {
+	entries, err := cacheEntries()
+	if err != nil {
+		return err
+	}
+	// The aws CLI doesn't record which profile an entry is for, but the usage stats do
+	// for entries written here
+	stats, err := loadUsage()
+	if err != nil {
+		return err
+	}
+	config, err := loadINI(sharedConfigPath())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tPROFILE\tROLE\tEXPIRES\tSTATE")
+	for _, entry := range entries {
+		profile, role := "-", "-"
+		if usage, ok := stats[entry.key]; ok {
+			profile = usage.Profile
+			if arn, ok := config.get(configSectionName(profile), "role_arn"); ok {
+				role = arn
+			}
+		}
+		if entry.item != nil && entry.item.Key != nil && entry.item.Key.RoleArn != "" {
+			role = entry.item.Key.RoleArn
+		}
+
+		expiration, state := "-", "unreadable"
+		if expires, ok := entry.expires(); ok {
+			expiration = expires.Local().Format(time.RFC1123)
+			state = "valid"
+			if time.Now().After(expires) {
+				state = "expired"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.name, profile, role, expiration, state)
+	}
+	return w.Flush()
+}
+
+// clearCacheEntries removes every entry with all. Otherwise it removes the entry the
+// credential flags resolve to, along with any other entries the usage stats attribute
+// to the profile, e.g. those written with a different -duration
+func clearCacheEntries(ctx context.Context, all, shred bool) error {
+	var names []string
+	if all {
+		entries, err := cacheEntries()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			names = append(names, entry.name)
+		}
+	} else {
+		src, err := newCredentialSource(ctx)
+		if err != nil {
+			return err
+		}
+		c := src.cache()
+		names = append([]string{c.name()}, c.legacyNames()...)
+
+		stats, err := loadUsage()
+		if err != nil {
+			return err
+		}
+		entries, err := cacheEntries()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if usage, ok := stats[entry.key]; ok && usage.Profile == profileOrDefault() {
+				names = append(names, entry.name)
+			}
+		}
+	}
+
+	removed := 0
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if err := removeCacheEntry(name, shred); errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		removed++
+	}
+	fmt.Fprintf(os.Stderr, "Removed %d cache entries\n", removed)
+	return nil
+}
+
+// pruneCacheEntries removes the entries whose credentials have expired. Entries that
+// can't be read, such as those encrypted for another user, are left alone
+func pruneCacheEntries(shred bool) error {
+	entries, err := cacheEntries()
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, entry := range entries {
+		if expires, ok := entry.expires(); ok && time.Now().After(expires) {
+			if err := removeCacheEntry(entry.name, shred); err != nil {
+				return err
+			}
+			removed++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Removed %d expired cache entries\n", removed)
+	return nil
+}
+
+// inspectCacheEntry shows the entry in the file at path, or else the entry named path in
+// the -cache-backend, e.g. from the output of list
+func inspectCacheEntry(path string) error {
+	// Encrypted entries are told apart by their extension
+	encrypted := strings.HasSuffix(path, ".dpapi")
+	item, err := readCacheItem(path, encrypted)
+	if errors.Is(err, os.ErrNotExist) {
+		var data []byte
+		if data, err = cacheBackend.Get(filepath.Base(path)); err == nil {
+			item, err = decodeCacheItem(data, encrypted)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	line := func(label, format string, a ...any) {
+		fmt.Fprintf(w, "%s:\t%s\n", label, fmt.Sprintf(format, a...))
+	}
+
+	line("file", "%s", filepath.Base(path))
+	line("schema version", "%d", item.SchemaVersion)
+	if item.Credentials != nil {
+		expires := time.Time(item.Credentials.Expiration)
+		state := "valid"
+		if time.Now().After(expires) {
+			state = "expired"
+		}
+		line("expiration", "%s (%s)", expires.Local().Format(time.RFC1123), state)
+	}
+
+	key := item.Key
+	if key == nil {
+		line("key inputs", "not recorded, the entry was written by the aws CLI or has no inputs the aws CLI lacks")
+		return w.Flush()
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if strings.Split(name, ".")[0] != computableCacheKey(*key).String() {
+		line("warning", "the file name does not match its key inputs, it may have been renamed")
+	}
+
+	optional := func(label, value string) {
+		if value != "" {
+			line(label, "%s", value)
+		}
+	}
+	optional("role", key.RoleArn)
+	optional("identity pool", key.IdentityPoolId)
+	if key.MFASession {
+		line("mfa session", "the IAM user's GetSessionToken session")
+	}
+	if len(key.Logins) > 0 {
+		line("logins", "%s", strings.Join(key.Logins, ", "))
+	}
+	if key.DurationSeconds > 0 {
+		line("duration", "%s", time.Duration(key.DurationSeconds)*time.Second)
+	}
+	optional("session name", key.RoleSessionName)
+	optional("external id", key.ExternalId)
+	optional("mfa device", key.SerialNumber)
+	optional("policy hash", key.PolicyHash)
+	optional("wrapped command", key.WrapCommand)
+	return w.Flush()
+}
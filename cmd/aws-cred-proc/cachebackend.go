@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ryandeivert/aws-cred-proc/pkg/cache"
+)
+
+// Values of -cache-backend
+const (
+	cacheBackendFile    = "file"
+	cacheBackendKeyring = "keyring"
+	cacheBackendMemory  = "memory"
+)
+
+var (
+	cacheBackendName string
+	// cacheBackend is where entries are stored, looked up from -cache-backend once the
+	// flags are checked
+	cacheBackend cache.Backend = cache.FileBackend{}
+	// memoryCache is shared by everything in the process using -cache-backend memory
+	memoryCache = cache.NewMemoryBackend()
+)
+
+// cacheBackends are the backends that can be selected with -cache-backend. They're
+// created once the flags are parsed, since the file backend writes with -file-mode
+var cacheBackends = map[string]func() (cache.Backend, error){
+	cacheBackendFile:    func() (cache.Backend, error) { return cache.FileBackend{Dir: cliCacheDir(), Mode: fileMode}, nil },
+	cacheBackendKeyring: newKeyringCacheBackend,
+	cacheBackendMemory:  func() (cache.Backend, error) { return memoryCache, nil },
+}
+
+// lookupCacheBackend returns the backend with the name
+func lookupCacheBackend(name string) (cache.Backend, error) {
+	if backend, ok := cacheBackends[name]; ok {
+		return backend()
+	}
+	names := make([]string, 0, len(cacheBackends))
+	for name := range cacheBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown -cache-backend %q, expected one of: %s", name, strings.Join(names, ", "))
+}
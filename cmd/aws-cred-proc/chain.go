@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// hopCacher caches each hop of a source_profile chain under its own key, so an inner
+// role, usually the one that needs MFA, is only assumed again once its own credentials
+// expire rather than whenever the outer role's do
+type hopCacher struct {
+	// source is the cache key of the credentials the next hop is assumed with, or nil if
+	// they aren't worth caching, like static keys
+	source *computableCacheKey
+	// assumed is set once the innermost hop is wrapped
+	assumed bool
+}
+
+// newHopCacher starts with the source credentials at the end of the profile's chain.
+// Those of a credential_process are cached the same as -wrap would cache them
+func newHopCacher(ctx context.Context) *hopCacher {
+	h := &hopCacher{}
+	shared, err := loadSharedProfile(ctx, profileOrDefault())
+	if err != nil {
+		return h
+	}
+	s := &shared
+	for s.Source != nil {
+		s = s.Source
+	}
+	if s.CredentialProcess != "" && s.RoleARN == "" {
+		h.source = &computableCacheKey{WrapCommand: s.CredentialProcess}
+	}
+	return h
+}
+
+// wrap is applied to the options of each hop's AssumeRole provider, innermost first. It
+// caches the credentials the hop's role is assumed with, then keeps the key of the hop's
+// own credentials for the next one. The outermost hop's are cached by the pipeline
+func (h *hopCacher) wrap(o *stscreds.AssumeRoleOptions) {
+	// The SDK also applies the options once without a client, only to validate them
+	if o.Client == nil {
+		return
+	}
+	client, ok := o.Client.(*sts.Client)
+	if ok && h.source != nil {
+		key := *h.source
+		client = sts.New(client.Options(), func(so *sts.Options) {
+			so.Credentials = aws.NewCredentialsCache(hopCacheProvider(so.Credentials, key))
+		})
+		o.Client = client
+	}
+	key := assumeRoleCacheKey(*o)
+	// Only the IAM user's own keys, at the end of the chain, can get a session token
+	if ok && !h.assumed && mfaSessionDuration > 0 && o.SerialNumber != nil {
+		useMFASession(o, client)
+	}
+	h.source = &key
+	h.assumed = true
+}
+
+// hopCacheProvider loads the credentials of an inner hop through the cache, refreshing
+// them with provider
+func hopCacheProvider(provider aws.CredentialsProvider, key computableCacheKey) aws.CredentialsProvider {
+	return aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		cache := NewCache(provider, false, dpapiCache, key)
+		creds, err := cache.Load(ctx)
+		if err == nil {
+			state := "miss"
+			if cache.hit {
+				state = "hit"
+			}
+			debugf("source credentials cache %s: %s", state, cache.location())
+		}
+		return creds, err
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const (
+	innerRole = "arn:aws:iam::111111111111:role/Inner"
+	outerRole = "arn:aws:iam::222222222222:role/Outer"
+)
+
+// fakeAssumeRole answers AssumeRole calls, recording the roles assumed
+func fakeAssumeRole(assumed *[]string) *http.Client {
+	return &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		params, _ := url.ParseQuery(string(body))
+		*assumed = append(*assumed, params.Get("RoleArn"))
+		response := fmt.Sprintf(`<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>ASIA%d</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`, len(*assumed))
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(response))}, nil
+	})}
+}
+
+// chainProvider builds the providers of a two hop chain from static keys the way the SDK
+// does, applying the hopCacher's wrap to each hop's options
+func chainProvider(httpClient *http.Client) aws.CredentialsProvider {
+	h := &hopCacher{}
+	var provider aws.CredentialsProvider = credentials.NewStaticCredentialsProvider("AKIA", "secret", "")
+	for _, role := range []string{innerRole, outerRole} {
+		client := sts.New(sts.Options{Region: "us-east-1", Credentials: provider, HTTPClient: httpClient})
+		provider = stscreds.NewAssumeRoleProvider(client, role, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "test"
+			h.wrap(o)
+		})
+	}
+	return provider
+}
+
+// The inner hop is cached under its own key, so the next run only assumes the outer role
+func TestHopCacherCachesInnerHop(t *testing.T) {
+	backend := useMemoryCache(t)
+	var assumed []string
+	httpClient := fakeAssumeRole(&assumed)
+
+	if _, err := chainProvider(httpClient).Retrieve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{innerRole, outerRole}; !slices.Equal(assumed, want) {
+		t.Fatalf("assumed %v, want %v", assumed, want)
+	}
+
+	assumed = nil
+	if _, err := chainProvider(httpClient).Retrieve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{outerRole}; !slices.Equal(assumed, want) {
+		t.Errorf("assumed %v with the inner hop cached, want %v", assumed, want)
+	}
+
+	names, err := backend.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := NewCache(nil, false, false, computableCacheKey{RoleArn: innerRole, RoleSessionName: "test"})
+	if !slices.Contains(names, inner.name()) {
+		t.Errorf("no entry %s for the inner hop, only %v", inner.name(), names)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "check",
+		usage: "resolve the profile's credentials and verify them with sts:GetCallerIdentity, printing the identity and how long the credentials remain valid. Exits with status 3 if they are expired, 4 if STS rejects them and 5 if they expire within -warn-within",
+		run:   runCheck,
+	})
+}
+
+// Exit statuses of check, along with exitCodeExpired
+const (
+	exitCodeInvalid    = 4
+	exitCodeNearExpiry = 5
+)
+
+func runCheck(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageWarnWithin = "exit with status 5 if the credentials expire within this long"
+	)
+	var warnWithin time.Duration
+
+	addCredentialFlags(fs)
+	fs.DurationVar(&warnWithin, "warn-within", 15*time.Minute, usageWarnWithin)
+	fs.Parse(args)
+
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+	creds, err := src.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	client := sts.New(sts.Options{
+		Credentials: credentials.StaticCredentialsProvider{Value: creds},
+		Region:      src.region,
+	}, withSTSOptions)
+	out, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		// Only an error response means STS rejected the credentials, rather than not answering
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || stsUnreachable(err) {
+			return fmt.Errorf("failed to verify credentials, %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Credentials for %q are invalid, %v\n", profileOrDefault(), err)
+		return &exitCodeError{exitCodeInvalid}
+	}
+
+	fmt.Printf("Profile:  %s\n", profileOrDefault())
+	fmt.Printf("Identity: %s\n", aws.ToString(out.Arn))
+	fmt.Printf("Account:  %s\n", aws.ToString(out.Account))
+	if !creds.CanExpire {
+		fmt.Println("Expires:  never")
+		return nil
+	}
+	remaining := time.Until(creds.Expires)
+	fmt.Printf("Expires:  %s (in %s)\n", creds.Expires.Local().Format(time.RFC1123), remaining.Round(time.Second))
+	if remaining < warnWithin {
+		return &exitCodeError{exitCodeNearExpiry}
+	}
+	return nil
+}
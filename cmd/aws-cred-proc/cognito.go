@@ -0,0 +1,168 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// CognitoProvider exchanges a Cognito identity for AWS credentials using the
+// identity pool's enhanced (simplified) authflow. Both GetId and
+// GetCredentialsForIdentity are unsigned calls, so no source credentials are needed
+type CognitoProvider struct {
+	IdentityPoolId string
+	Logins         cognitoLogins
+	CustomRoleArn  string
+	client         *http.Client
+}
+
+// newCognitoSource returns the credential source for -cognito-pool
+func newCognitoSource() (*credentialSource, error) {
+	p := NewCognitoProvider(cognitoPool, cognitoLogin, cognitoRoleArn)
+	region, _ := p.region()
+	return &credentialSource{
+		provider:     p,
+		cacheKey:     p.cacheKey(),
+		region:       region,
+		regionSource: "identity pool id",
+	}, nil
+}
+
+func NewCognitoProvider(poolId string, logins cognitoLogins, roleArn string) *CognitoProvider {
+	return &CognitoProvider{
+		IdentityPoolId: poolId,
+		Logins:         logins,
+		CustomRoleArn:  roleArn,
+		client:         httpClient(),
+	}
+}
+
+// Identity pool ids are of the form <region>:<uuid>
+func (p *CognitoProvider) region() (string, error) {
+	region, _, ok := strings.Cut(p.IdentityPoolId, ":")
+	if !ok || region == "" {
+		return "", fmt.Errorf("invalid identity pool id %q", p.IdentityPoolId)
+	}
+	return region, nil
+}
+
+// cacheKey includes a hash of the login tokens, so logging in as another user of the
+// same providers doesn't return the previous user's cached identity
+func (p *CognitoProvider) cacheKey() computableCacheKey {
+	key := computableCacheKey{IdentityPoolId: p.IdentityPoolId, RoleArn: p.CustomRoleArn}
+	for provider := range p.Logins {
+		key.Logins = append(key.Logins, provider)
+	}
+	sort.Strings(key.Logins)
+	if len(key.Logins) > 0 {
+		hash := sha256.New()
+		for _, provider := range key.Logins {
+			fmt.Fprintf(hash, "%s=%s\n", provider, p.Logins[provider])
+		}
+		key.LoginsHash = hex.EncodeToString(hash.Sum(nil))
+	}
+	return key
+}
+
+func (p *CognitoProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	var getIdOut struct {
+		IdentityId string
+	}
+	err := p.call(ctx, "GetId", map[string]any{
+		"IdentityPoolId": p.IdentityPoolId,
+		"Logins":         p.Logins,
+	}, &getIdOut)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	input := map[string]any{
+		"IdentityId": getIdOut.IdentityId,
+		"Logins":     p.Logins,
+	}
+	if p.CustomRoleArn != "" {
+		input["CustomRoleArn"] = p.CustomRoleArn
+	}
+
+	var credsOut struct {
+		Credentials struct {
+			AccessKeyId  string
+			SecretKey    string
+			SessionToken string
+			Expiration   float64 // epoch seconds
+		}
+	}
+	if err := p.call(ctx, "GetCredentialsForIdentity", input, &credsOut); err != nil {
+		return aws.Credentials{}, err
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     credsOut.Credentials.AccessKeyId,
+		SecretAccessKey: credsOut.Credentials.SecretKey,
+		SessionToken:    credsOut.Credentials.SessionToken,
+		Source:          "CognitoIdentity",
+		CanExpire:       true,
+		Expires:         time.Unix(int64(credsOut.Credentials.Expiration), 0).UTC(),
+	}, nil
+}
+
+func (p *CognitoProvider) call(ctx context.Context, operation string, input, output any) error {
+	region, err := p.region()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request, %w", operation, err)
+	}
+
+	service := "cognito-identity"
+	if useFIPSEndpoint {
+		service += "-fips"
+	}
+	url := fmt.Sprintf("https://%s.%s.%s/", service, region, partitionDNSSuffix(regionPartition(region)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSCognitoIdentityService."+operation)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call cognito %s, %w", operation, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read cognito %s response, %w", operation, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("cognito %s failed (%d): %s %s", operation, resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+
+	if err := json.Unmarshal(data, output); err != nil {
+		return fmt.Errorf("failed to decode cognito %s response, %w", operation, err)
+	}
+	return nil
+}
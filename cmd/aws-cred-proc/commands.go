@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// command is a subcommand invoked as the first argument, e.g. `aws-cred-proc emit-config ...`
+// Invoking the binary without a subcommand behaves as a credential_process
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, fs *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]*command{}
+
+// exitCodeError is returned by commands that run another program, so this one
+// exits with the same status without logging anything else
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func registerCommand(cmd *command) {
+	commands[cmd.name] = cmd
+}
+
+// flagSet returns a FlagSet for the subcommand with a usage function
+// that includes the subcommand's description
+func (cmd *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage aws-cred-proc %s:\n  %s\n\n", cmd.name, cmd.usage)
+		printDefaults(fs)
+	}
+	return fs
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+	printDefaults(flag.CommandLine)
+
+	if len(commands) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(out, "\nCommands (run `%s <command> -h` for command flags):\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s\n    \t%s\n", name, commands[name].usage)
+	}
+}
+
+// printDefaults is fs.PrintDefaults without the deprecated flags
+func printDefaults(fs *flag.FlagSet) {
+	visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	visible.SetOutput(fs.Output())
+	fs.VisitAll(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Usage, deprecatedPrefix) {
+			return
+		}
+		visible.Var(f.Value, f.Name, f.Usage)
+		// Var takes the current value as the default, which parsing may have changed
+		visible.Lookup(f.Name).DefValue = f.DefValue
+	})
+	visible.PrintDefaults()
+}
@@ -0,0 +1,178 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ryandeivert/aws-cred-proc/internal/shell"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "completion",
+		usage: "print a shell completion script for bash, zsh, fish or powershell, which completes commands, flags and the profiles in ~/.aws/config, e.g. source <(aws-cred-proc completion bash)",
+		run:   runCompletion,
+	})
+}
+
+// completionData is what the completion scripts are generated from
+type completionData struct {
+	exe      string // the path of this binary, which the scripts call to list profiles
+	name     string // the command name being completed
+	commands []string
+	flags    []*flag.Flag
+}
+
+// flagNames returns the flags the way they are usually written, -p and --profile
+func (c completionData) flagNames() []string {
+	names := make([]string, len(c.flags))
+	for i, f := range c.flags {
+		names[i] = flagName(f)
+	}
+	return names
+}
+
+func flagName(f *flag.Flag) string {
+	if len(f.Name) == 1 {
+		return "-" + f.Name
+	}
+	return "--" + f.Name
+}
+
+// profileFlags are the words after which profiles are completed
+const profileFlags = "-p --p -profile --profile"
+
+// fishEscaper escapes the characters that are special inside a single quoted fish string
+var fishEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// completionScripts write the completion script for each shell
+var completionScripts = map[string]func(w io.Writer, c completionData) error{
+	"bash": func(w io.Writer, c completionData) error {
+		_, err := fmt.Fprintf(w, `_aws_cred_proc() {
+  local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+  case " %[5]s " in
+    *" $prev "*)
+      COMPREPLY=($(compgen -W "$(%[1]s completion profiles 2>/dev/null)" -- "$cur"))
+      return ;;
+  esac
+  if [[ $COMP_CWORD -eq 1 && "$cur" != -* ]]; then
+    COMPREPLY=($(compgen -W "%[3]s" -- "$cur"))
+  else
+    COMPREPLY=($(compgen -W "%[4]s" -- "$cur"))
+  fi
+}
+complete -F _aws_cred_proc %[2]s %[1]s
+`, shell.Quote(c.exe), c.name, strings.Join(c.commands, " "), strings.Join(c.flagNames(), " "), profileFlags)
+		return err
+	},
+	"zsh": func(w io.Writer, c completionData) error {
+		_, err := fmt.Fprintf(w, `_aws_cred_proc() {
+  case " %[5]s " in
+    *" ${words[CURRENT-1]} "*)
+      compadd -- ${(f)"$(%[1]s completion profiles 2>/dev/null)"}
+      return ;;
+  esac
+  if (( CURRENT == 2 )) && [[ "$PREFIX" != -* ]]; then
+    compadd -- %[3]s
+  else
+    compadd -- %[4]s
+  fi
+}
+compdef _aws_cred_proc %[2]s
+`, shell.Quote(c.exe), c.name, strings.Join(c.commands, " "), strings.Join(c.flagNames(), " "), profileFlags)
+		return err
+	},
+	"fish": func(w io.Writer, c completionData) error {
+		quote := func(s string) string {
+			return "'" + fishEscaper.Replace(s) + "'"
+		}
+		lines := []string{
+			fmt.Sprintf("complete -c %s -f", c.name),
+			fmt.Sprintf("complete -c %s -n __fish_use_subcommand -a %s", c.name, quote(strings.Join(c.commands, " "))),
+		}
+		for _, f := range c.flags {
+			option := "-l " + f.Name
+			if len(f.Name) == 1 {
+				option = "-s " + f.Name
+			}
+			line := fmt.Sprintf("complete -c %s %s -d %s", c.name, option, quote(f.Usage))
+			if f.Name == "p" || f.Name == "profile" {
+				line += fmt.Sprintf(" -x -a '(%s completion profiles 2>/dev/null)'", strings.ReplaceAll(quote(c.exe), "'", `\'`))
+			} else if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+				line += " -r"
+			}
+			lines = append(lines, line)
+		}
+		_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+		return err
+	},
+	"powershell": func(w io.Writer, c completionData) error {
+		quote := func(s string) string {
+			return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+		}
+		_, err := fmt.Fprintf(w, `Register-ArgumentCompleter -Native -CommandName %[2]s, %[6]s -ScriptBlock {
+  param($wordToComplete, $commandAst, $cursorPosition)
+  $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+  $index = if ($wordToComplete) { $words.Count - 2 } else { $words.Count - 1 }
+  $prev = if ($index -ge 0) { $words[$index] } else { '' }
+  if ((%[5]s -split ' ') -contains $prev) {
+    $candidates = & %[1]s completion profiles 2>$null
+  } elseif ($index -eq 0 -and -not $wordToComplete.StartsWith('-')) {
+    $candidates = %[3]s -split ' '
+  } else {
+    $candidates = %[4]s -split ' '
+  }
+  $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+    [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+  }
+}
+`, quote(c.exe), quote(c.name), quote(strings.Join(c.commands, " ")), quote(strings.Join(c.flagNames(), " ")), quote(profileFlags), quote(c.name+".exe"))
+		return err
+	},
+}
+
+func runCompletion(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+
+	// Called by the scripts, to complete profiles when the shell asks for them
+	if fs.Arg(0) == "profiles" {
+		profiles, err := configProfiles()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Println(strings.Join(profiles, "\n"))
+		return err
+	}
+
+	script, ok := completionScripts[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q, expected bash, zsh, fish or powershell", fs.Arg(0))
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable, %w", err)
+	}
+	c := completionData{
+		exe:  exe,
+		name: strings.TrimSuffix(filepath.Base(exe), ".exe"),
+	}
+	for name := range commands {
+		c.commands = append(c.commands, name)
+	}
+	sort.Strings(c.commands)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Usage, deprecatedPrefix) {
+			c.flags = append(c.flags, f)
+		}
+	})
+	return script(os.Stdout, c)
+}
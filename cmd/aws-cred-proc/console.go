@@ -0,0 +1,149 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "console",
+		usage: "print (or open) a sign-in URL for the AWS Console with the profile's session, using the federation endpoint",
+		run:   runConsole,
+	})
+}
+
+// consoleSignInTimeout is how long the federation endpoint is waited on
+const consoleSignInTimeout = 30 * time.Second
+
+// consoleEndpoints returns the federation and console hosts of the region's partition
+func consoleEndpoints(region string) (string, string) {
+	switch regionPartition(region) {
+	case partitionAWSUSGov:
+		return "signin.amazonaws-us-gov.com", "console.amazonaws-us-gov.com"
+	case partitionAWSCN:
+		return "signin.amazonaws.cn", "console.amazonaws.cn"
+	default:
+		return "signin.aws.amazon.com", "console.aws.amazon.com"
+	}
+}
+
+// consoleDestination returns the console URL to land on. The destination may be a
+// full URL, or the name of a service such as s3 or ec2
+func consoleDestination(destination, host, region string) string {
+	if strings.HasPrefix(destination, "https://") {
+		return destination
+	}
+	if destination == "" {
+		destination = "console"
+	}
+	return fmt.Sprintf("https://%s/%s/home?region=%s", host, strings.Trim(destination, "/"), url.QueryEscape(region))
+}
+
+// consoleSignInURL exchanges the session for a sign-in token, and returns the URL that
+// signs in with it. The console session lasts for as long as the credentials do
+func consoleSignInURL(ctx context.Context, creds aws.Credentials, region, destination string) (string, error) {
+	if creds.SessionToken == "" {
+		return "", fmt.Errorf("signing in to the console requires temporary credentials, such as those of a role")
+	}
+
+	session, err := json.Marshal(map[string]string{
+		"sessionId":    creds.AccessKeyID,
+		"sessionKey":   creds.SecretAccessKey,
+		"sessionToken": creds.SessionToken,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session, %w", err)
+	}
+
+	signinHost, consoleHost := consoleEndpoints(region)
+	federation := "https://" + signinHost + "/federation"
+
+	query := url.Values{"Action": {"getSigninToken"}, "Session": {string(session)}}
+	ctx, cancel := context.WithTimeout(ctx, consoleSignInTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, federation+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		// The request URL holds the session, so keep it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", fmt.Errorf("failed to call the federation endpoint, %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the federation endpoint response, %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("federation endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var token struct {
+		SigninToken string
+	}
+	if err := json.Unmarshal(data, &token); err != nil || token.SigninToken == "" {
+		return "", fmt.Errorf("failed to decode the federation endpoint response")
+	}
+
+	login := url.Values{
+		"Action":      {"login"},
+		"Issuer":      {"aws-cred-proc"},
+		"Destination": {consoleDestination(destination, consoleHost, region)},
+		"SigninToken": {token.SigninToken},
+	}
+	return federation + "?" + login.Encode(), nil
+}
+
+func runConsole(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageDestination = "the `service` (e.g. s3, ec2) or full console URL to land on. Defaults to the console home"
+		usageOpen        = "open the URL in the default browser instead of printing it"
+	)
+	var destination string
+	var open bool
+
+	addCredentialFlags(fs)
+	fs.StringVar(&destination, "destination", "", usageDestination)
+	fs.BoolVar(&open, "open", false, usageOpen)
+	fs.Parse(args)
+
+	creds, region, err := resolveCredentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	signIn, err := consoleSignInURL(ctx, creds, region, destination)
+	if err != nil {
+		return err
+	}
+
+	if open {
+		if err := openBrowser(signIn); err != nil {
+			return fmt.Errorf("failed to open the browser, %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Opened the console for %q, signed in until %s\n", profileOrDefault(), creds.Expires.Local().Format(time.RFC1123))
+		return nil
+	}
+	fmt.Fprintln(os.Stdout, signIn)
+	return nil
+}
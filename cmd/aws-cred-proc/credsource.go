@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// Values of credential_source, which the SDK resolves the source credentials of a role
+// profile from in place of a source_profile
+const (
+	credSourceEnvironment = "Environment"
+	credSourceEC2         = "Ec2InstanceMetadata"
+	credSourceECS         = "EcsContainer"
+)
+
+// profileCredentialSource returns the credential_source at the end of the profile's
+// source_profile chain, and the profile that sets it, or "" if there is none
+func profileCredentialSource(ctx context.Context) (string, string) {
+	shared, err := loadSharedProfile(ctx, profileOrDefault())
+	if err != nil {
+		return "", ""
+	}
+	for s := &shared; s != nil; s = s.Source {
+		if s.CredentialSource != "" {
+			return s.CredentialSource, s.Profile
+		}
+	}
+	return "", ""
+}
+
+// checkCredentialSource fails early, and more clearly than the SDK would on the first
+// request, when the profile's credential_source can't provide credentials
+func checkCredentialSource(source, name string) error {
+	switch source {
+	case "":
+		return nil
+	case credSourceEnvironment:
+		env, err := config.NewEnvConfig()
+		if err != nil {
+			return err
+		}
+		if !env.Credentials.HasKeys() {
+			return fmt.Errorf("profile %s has credential_source %s, but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set", name, source)
+		}
+	case credSourceEC2:
+		if imdsDisabled() {
+			return fmt.Errorf("profile %s has credential_source %s, which can't be used with -no-imds or AWS_EC2_METADATA_DISABLED", name, source)
+		}
+	case credSourceECS:
+		if noIMDS {
+			return fmt.Errorf("profile %s has credential_source %s, which can't be used with -no-imds", name, source)
+		}
+	default:
+		return fmt.Errorf("invalid credential_source %q in profile %s, expected %s, %s or %s", source, name, credSourceEnvironment, credSourceEC2, credSourceECS)
+	}
+	return nil
+}
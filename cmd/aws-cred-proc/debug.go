@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// debugLog enables the messages of debugf, set with -debug
+var debugLog bool
+
+// debugf logs a message with -debug. Like every other message it goes to stderr, so it
+// never mixes with the credentials on stdout. Never pass it secrets
+func debugf(format string, a ...any) {
+	if debugLog {
+		log.Printf("debug: "+format, a...)
+	}
+}
+
+// profileChain returns the profile followed by its source_profile, that profile's
+// source_profile and so on, the order the SDK resolves them in. A credential_source at
+// the end of the chain is included too
+func profileChain(ctx context.Context) []string {
+	name := profileOrDefault()
+	seen := map[string]bool{}
+	var chain []string
+	for name != "" && !seen[name] {
+		seen[name] = true
+		chain = append(chain, name)
+		shared, err := loadSharedProfile(ctx, name)
+		if err != nil || shared.SourceProfileName == name {
+			break
+		}
+		if shared.CredentialSource != "" {
+			chain = append(chain, "credential_source "+shared.CredentialSource)
+		}
+		name = shared.SourceProfileName
+	}
+	return chain
+}
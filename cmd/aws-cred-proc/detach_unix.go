@@ -0,0 +1,14 @@
+//go:build !windows && !credproc_min
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts the command in its own session so it outlives the
+// calling shell and is not sent its SIGHUP
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
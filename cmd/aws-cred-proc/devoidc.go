@@ -0,0 +1,269 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/ryandeivert/aws-cred-proc/pkg/output"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "dev-oidc",
+		usage: "run a minimal local OIDC issuer for testing web identity (IRSA-style) role assumption. Subcommands: serve (serve the discovery document and JWKS), token (print a signed token), assume (serve, then exchange a token for credentials with AssumeRoleWithWebIdentity)",
+		run:   runDevOIDC,
+	})
+}
+
+const (
+	devOIDCKeyBits        = 2048
+	devOIDCTokenLifetime  = time.Hour
+	devOIDCDiscoveryPath  = "/.well-known/openid-configuration"
+	devOIDCJWKSPath       = "/keys"
+	devOIDCDefaultListen  = "127.0.0.1:8080"
+	devOIDCDefaultSubject = "system:serviceaccount:default:dev"
+)
+
+// devOIDCIssuer signs tokens with a key kept in the state directory, so the issuer's
+// keys stay the same across runs and only need to be registered with IAM once
+type devOIDCIssuer struct {
+	url string
+	key *rsa.PrivateKey
+	kid string
+}
+
+func devOIDCKeyPath() string {
+	return filepath.Join(stateDir(), "dev-oidc", "key.pem")
+}
+
+func loadDevOIDCIssuer(url string) (*devOIDCIssuer, error) {
+	if url == "" {
+		return nil, fmt.Errorf("dev-oidc requires -issuer, the https URL STS can reach this issuer at (e.g. through a tunnel)")
+	}
+
+	path := devOIDCKeyPath()
+	var key *rsa.PrivateKey
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no PEM data found in %s", path)
+		}
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to parse %s, %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if key, err = rsa.GenerateKey(rand.Reader, devOIDCKeyBits); err != nil {
+			return nil, fmt.Errorf("failed to generate signing key, %w", err)
+		}
+		if err := makeDirs(filepath.Dir(path)); err != nil {
+			return nil, fmt.Errorf("failed to make directories, %w", err)
+		}
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		if err := writeFile(path, pem.EncodeToMemory(block)); err != nil {
+			return nil, fmt.Errorf("failed to write signing key, %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("failed to read signing key, %w", err)
+	}
+
+	// The key ID is a thumbprint of the public key, so it changes if the key is replaced
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+	return &devOIDCIssuer{
+		url: strings.TrimSuffix(url, "/"),
+		key: key,
+		kid: base64.RawURLEncoding.EncodeToString(sum[:8]),
+	}, nil
+}
+
+func (i *devOIDCIssuer) discovery() map[string]any {
+	return map[string]any{
+		"issuer":                                i.url,
+		"jwks_uri":                              i.url + devOIDCJWKSPath,
+		"response_types_supported":              []string{"id_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	}
+}
+
+func (i *devOIDCIssuer) jwks() map[string]any {
+	pub := i.key.PublicKey
+	return map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": i.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	}
+}
+
+// token signs an RS256 JWT for the subject and audience
+func (i *devOIDCIssuer) token(subject, audience string) (string, error) {
+	now := time.Now()
+	header := map[string]string{"alg": "RS256", "typ": "JWT", "kid": i.kid}
+	claims := map[string]any{
+		"iss": i.url,
+		"sub": subject,
+		"aud": audience,
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(devOIDCTokenLifetime).Unix(),
+	}
+
+	var parts []string
+	for _, v := range []any{header, claims} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode token, %w", err)
+		}
+		parts = append(parts, base64.RawURLEncoding.EncodeToString(data))
+	}
+
+	signed := strings.Join(parts, ".")
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token, %w", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// serve serves the discovery document and JWKS until the listener is closed
+func (i *devOIDCIssuer) serve(listener net.Listener) error {
+	mux := http.NewServeMux()
+	handle := func(path string, body func() map[string]any) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(body())
+		})
+	}
+	handle(devOIDCDiscoveryPath, i.discovery)
+	handle(devOIDCJWKSPath, i.jwks)
+
+	err := http.Serve(listener, mux)
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func runDevOIDC(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageIssuer   = "the https URL STS can reach the issuer at, e.g. a tunnel to -listen. Register it as an IAM OIDC identity provider once (required)"
+		usageListen   = "the address to serve the discovery document and JWKS on (serve and assume)"
+		usageSubject  = "the sub claim of the token (token and assume)"
+		usageAudience = "the aud claim of the token, which must be a client ID of the IAM OIDC identity provider (token and assume)"
+		usageRoleArn  = "the ARN of the test role to assume, which must trust the issuer (assume only)"
+		usageProfile  = "the optional aws config profile whose region STS is called in (assume only)"
+		usageDuration = "duration for which the credentials will remain valid (assume only)"
+	)
+	var issuerURL, listen, subject, audience, roleArn string
+
+	fs.StringVar(&issuerURL, "issuer", "", usageIssuer)
+	fs.StringVar(&listen, "listen", devOIDCDefaultListen, usageListen)
+	fs.StringVar(&subject, "subject", devOIDCDefaultSubject, usageSubject)
+	fs.StringVar(&audience, "audience", "sts.amazonaws.com", usageAudience)
+	fs.StringVar(&roleArn, "role-arn", "", usageRoleArn)
+	fs.StringVar(&profile, "profile", "", usageProfile)
+	fs.DurationVar(&duration, "duration", time.Hour, usageDuration)
+
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("dev-oidc requires one of: serve, token, assume")
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	issuer, err := loadDevOIDCIssuer(issuerURL)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "serve":
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s, %w", listen, err)
+		}
+		fmt.Fprintf(os.Stderr, "Serving the OIDC discovery document for %s on http://%s%s\n", issuer.url, listen, devOIDCDiscoveryPath)
+		return issuer.serve(listener)
+	case "token":
+		token, err := issuer.token(subject, audience)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, token)
+		return nil
+	case "assume":
+		if roleArn == "" {
+			return fmt.Errorf("dev-oidc assume requires -role-arn")
+		}
+		return devOIDCAssume(ctx, issuer, listen, roleArn, subject, audience)
+	default:
+		return fmt.Errorf("unknown dev-oidc subcommand %q", action)
+	}
+}
+
+// devOIDCAssume serves the issuer for as long as STS needs to fetch its keys, and
+// prints the credentials for the role in the credential_process format
+func devOIDCAssume(ctx context.Context, issuer *devOIDCIssuer, listen, roleArn, subject, audience string) error {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s, %w", listen, err)
+	}
+	defer listener.Close()
+	go issuer.serve(listener)
+
+	token, err := issuer.token(subject, audience)
+	if err != nil {
+		return err
+	}
+
+	region, _ := resolveRegion(ctx)
+	client := sts.New(sts.Options{
+		Credentials: aws.AnonymousCredentials{},
+		Region:      region,
+	})
+	out, err := client.AssumeRoleWithWebIdentity(ctx, &sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(roleArn),
+		RoleSessionName:  aws.String(sanitizeRoleSessionName("dev-oidc-" + subject)),
+		WebIdentityToken: aws.String(token),
+		DurationSeconds:  aws.Int32(int32(duration.Seconds())),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to assume %s with web identity, %w", roleArn, err)
+	}
+
+	return writeToStdOut(output.NewProcessCredentials(aws.Credentials{
+		AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		CanExpire:       true,
+		Expires:         aws.ToTime(out.Credentials.Expiration),
+	}))
+}
@@ -0,0 +1,11 @@
+//go:build !credproc_min
+
+package main
+
+import "github.com/ryandeivert/aws-cred-proc/pkg/mfa"
+
+// dialogPrompt asks for the MFA code with an AppleScript dialog
+func dialogPrompt() (string, error) {
+	const script = `text returned of (display dialog "MFA Code:" default answer "" with hidden answer with title "aws-cred-proc")`
+	return mfa.Command("osascript", "-e", script)
+}
@@ -0,0 +1,21 @@
+//go:build !darwin && !windows && !credproc_min
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/ryandeivert/aws-cred-proc/pkg/mfa"
+)
+
+// dialogPrompt asks for the MFA code with zenity (GTK), falling back on kdialog (KDE)
+func dialogPrompt() (string, error) {
+	if _, err := exec.LookPath("zenity"); err == nil {
+		return mfa.Command("zenity", "--entry", "--hide-text", "--title=aws-cred-proc", "--text=MFA Code:")
+	}
+	if _, err := exec.LookPath("kdialog"); err == nil {
+		return mfa.Command("kdialog", "--title", "aws-cred-proc", "--password", "MFA Code:")
+	}
+	return "", fmt.Errorf("neither zenity nor kdialog were found to prompt for the MFA code")
+}
@@ -0,0 +1,12 @@
+//go:build !credproc_min
+
+package main
+
+import "github.com/ryandeivert/aws-cred-proc/pkg/mfa"
+
+// dialogPrompt asks for the MFA code with the Visual Basic InputBox, which is
+// available to PowerShell on every Windows install
+func dialogPrompt() (string, error) {
+	const script = `Add-Type -AssemblyName Microsoft.VisualBasic; [Microsoft.VisualBasic.Interaction]::InputBox('MFA Code:', 'aws-cred-proc')`
+	return mfa.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script)
+}
@@ -0,0 +1,17 @@
+//go:build !windows && !credproc_min
+
+package main
+
+import "fmt"
+
+const dpapiSupported = false
+
+var errDPAPIUnsupported = fmt.Errorf("DPAPI is only available on Windows")
+
+func dpapiProtect(data []byte) ([]byte, error) {
+	return nil, errDPAPIUnsupported
+}
+
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	return nil, errDPAPIUnsupported
+}
@@ -0,0 +1,73 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Cache files are encrypted with DPAPI, which binds them to the current Windows user
+
+var (
+	crypt32                = syscall.NewLazyDLL("crypt32.dll")
+	procCryptProtectData   = crypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = crypt32.NewProc("CryptUnprotectData")
+	procLocalFree          = kernel32.NewProc("LocalFree")
+)
+
+const (
+	dpapiSupported          = true
+	cryptProtectUIForbidden = 0x1
+)
+
+// dataBlob mirrors the Win32 DATA_BLOB struct
+type dataBlob struct {
+	Size uint32
+	Data *byte
+}
+
+func newDataBlob(data []byte) *dataBlob {
+	blob := &dataBlob{Size: uint32(len(data))}
+	if len(data) > 0 {
+		blob.Data = &data[0]
+	}
+	return blob
+}
+
+// take copies the blob's data and frees the memory Windows allocated for it
+func (b *dataBlob) take() []byte {
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(b.Data)))
+	return append([]byte(nil), unsafe.Slice(b.Data, b.Size)...)
+}
+
+// The service name is used as additional entropy, so other programs running as
+// the user can't decrypt the cache with a bare CryptUnprotectData call
+var dpapiEntropy = []byte(keyringService)
+
+func dpapiProtect(data []byte) ([]byte, error) {
+	var out dataBlob
+	r, _, err := procCryptProtectData.Call(
+		uintptr(unsafe.Pointer(newDataBlob(data))), 0,
+		uintptr(unsafe.Pointer(newDataBlob(dpapiEntropy))), 0, 0,
+		cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)),
+	)
+	if r == 0 {
+		return nil, fmt.Errorf("failed to encrypt with DPAPI, %w", err)
+	}
+	return out.take(), nil
+}
+
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	var out dataBlob
+	r, _, err := procCryptUnprotectData.Call(
+		uintptr(unsafe.Pointer(newDataBlob(data))), 0,
+		uintptr(unsafe.Pointer(newDataBlob(dpapiEntropy))), 0, 0,
+		cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)),
+	)
+	if r == 0 {
+		return nil, fmt.Errorf("failed to decrypt with DPAPI, %w", err)
+	}
+	return out.take(), nil
+}
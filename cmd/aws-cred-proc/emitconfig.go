@@ -0,0 +1,177 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "emit-config",
+		usage: "write a self-contained config and credentials file pair for tools that cannot see your home directory",
+		run:   runEmitConfig,
+	})
+}
+
+const (
+	emittedConfigFile      = "config"
+	emittedCredentialsFile = "credentials"
+	// emittedExpiresPrefix starts the comment recording when the emitted credentials expire
+	emittedExpiresPrefix = "# expires "
+)
+
+func runEmitConfig(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageOut       = "directory to write the config and credentials files to (required)"
+		usageNoCleanup = "leave the files in place after the credentials expire instead of removing them"
+		usageCleanupAt = "remove previously emitted files from -out at this RFC3339 time and exit. Used internally by the cleanup process"
+	)
+	var out, cleanupAt string
+	var noCleanup bool
+
+	addCredentialFlags(fs)
+	fs.StringVar(&out, "out", "", usageOut)
+	fs.StringVar(&out, "o", "", shorthandPrefix+"-out")
+	fs.BoolVar(&noCleanup, "no-cleanup", false, usageNoCleanup)
+	fs.StringVar(&cleanupAt, "cleanup-at", "", usageCleanupAt)
+	fs.Parse(args)
+
+	if out == "" {
+		return fmt.Errorf("emit-config requires -out")
+	}
+
+	if cleanupAt != "" {
+		at, err := time.Parse(time.RFC3339, cleanupAt)
+		if err != nil {
+			return fmt.Errorf("invalid -cleanup-at value, %w", err)
+		}
+		time.Sleep(time.Until(at))
+		return removeEmittedConfig(out, at)
+	}
+
+	creds, region, err := resolveCredentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := writeEmittedConfig(out, creds, region); err != nil {
+		return err
+	}
+
+	if !noCleanup && creds.CanExpire {
+		if err := scheduleEmittedConfigCleanup(out, creds.Expires); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "export AWS_CONFIG_FILE=%s\n", filepath.Join(out, emittedConfigFile))
+	fmt.Fprintf(os.Stdout, "export AWS_SHARED_CREDENTIALS_FILE=%s\n", filepath.Join(out, emittedCredentialsFile))
+	return nil
+}
+
+// writeEmittedConfig writes a config file containing only the region and a credentials
+// file containing only the session credentials. The default profile is always written,
+// along with a section for the named profile, so AWS_PROFILE can be left as-is
+func writeEmittedConfig(dir string, creds aws.Credentials, region string) error {
+	if err := makeDirs(dir); err != nil {
+		return fmt.Errorf("failed to make directories, %w", err)
+	}
+
+	configSections := []string{"default"}
+	credentialSections := []string{"default"}
+	if profile != "" && profile != "default" {
+		configSections = append(configSections, "profile "+profile)
+		credentialSections = append(credentialSections, profile)
+	}
+
+	var cfg, credsFile strings.Builder
+	if creds.CanExpire {
+		fmt.Fprintf(&credsFile, "%s%s\n\n", emittedExpiresPrefix, creds.Expires.UTC().Format(time.RFC3339))
+	}
+	for _, section := range configSections {
+		fmt.Fprintf(&cfg, "[%s]\n", section)
+		if region != "" {
+			fmt.Fprintf(&cfg, "region = %s\n", region)
+		}
+		cfg.WriteString("\n")
+	}
+	for _, section := range credentialSections {
+		fmt.Fprintf(&credsFile, "[%s]\n", section)
+		fmt.Fprintf(&credsFile, "aws_access_key_id = %s\n", creds.AccessKeyID)
+		fmt.Fprintf(&credsFile, "aws_secret_access_key = %s\n", creds.SecretAccessKey)
+		if creds.SessionToken != "" {
+			fmt.Fprintf(&credsFile, "aws_session_token = %s\n", creds.SessionToken)
+		}
+		credsFile.WriteString("\n")
+	}
+
+	if err := writeFile(filepath.Join(dir, emittedConfigFile), []byte(cfg.String())); err != nil {
+		return fmt.Errorf("failed to write config file, %w", err)
+	}
+	if err := writeFile(filepath.Join(dir, emittedCredentialsFile), []byte(credsFile.String())); err != nil {
+		return fmt.Errorf("failed to write credentials file, %w", err)
+	}
+	return nil
+}
+
+// emittedExpiry returns when the credentials emitted to dir expire, if they do
+func emittedExpiry(dir string) (time.Time, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, emittedCredentialsFile))
+	if err != nil {
+		return time.Time{}, false
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	value, ok := strings.CutPrefix(line, emittedExpiresPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	expires, err := time.Parse(time.RFC3339, value)
+	return expires, err == nil
+}
+
+// removeEmittedConfig removes the files emitted to dir, unless they were emitted again
+// since the credentials that expire at expires were. Those have their own cleanup
+func removeEmittedConfig(dir string, expires time.Time) error {
+	if current, ok := emittedExpiry(dir); !ok || !current.Equal(expires) {
+		return nil
+	}
+	for _, name := range []string{emittedConfigFile, emittedCredentialsFile} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s, %w", name, err)
+		}
+	}
+	// Only removes the directory if nothing else was put in it
+	_ = os.Remove(dir)
+	return nil
+}
+
+// scheduleEmittedConfigCleanup starts a detached copy of this binary that
+// removes the emitted files once the credentials in them have expired
+func scheduleEmittedConfigCleanup(dir string, expires time.Time) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable for cleanup, %w", err)
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, "emit-config", "-out", abs, "-cleanup-at", expires.UTC().Format(time.RFC3339))
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start cleanup process, %w", err)
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,51 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestRemoveEmittedConfig(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "emitted")
+	emit := func(expires time.Time) time.Time {
+		t.Helper()
+		creds := aws.Credentials{AccessKeyID: "ASIA", SecretAccessKey: "secret", CanExpire: true, Expires: expires}
+		if err := writeEmittedConfig(dir, creds, "us-east-1"); err != nil {
+			t.Fatal(err)
+		}
+		// As the cleanup process is passed it
+		at, _ := time.Parse(time.RFC3339, expires.UTC().Format(time.RFC3339))
+		return at
+	}
+	exists := func() bool {
+		_, err := os.Stat(filepath.Join(dir, emittedCredentialsFile))
+		return err == nil
+	}
+
+	first := emit(time.Now().Add(time.Hour))
+	second := emit(time.Now().Add(2 * time.Hour))
+
+	// The first cleanup leaves the files emitted again since
+	if err := removeEmittedConfig(dir, first); err != nil {
+		t.Fatal(err)
+	}
+	if !exists() {
+		t.Fatal("the first cleanup removed the credentials emitted after it was scheduled")
+	}
+
+	if err := removeEmittedConfig(dir, second); err != nil {
+		t.Fatal(err)
+	}
+	if exists() {
+		t.Error("the cleanup of the emitted credentials left them in place")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("the emptied directory was left in place, %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// outputEncryptors encrypt the output for -encrypt-to <scheme>:<recipient>, keyed by scheme
+var outputEncryptors = map[string]func(recipient string, data []byte) ([]byte, error){
+	"age": ageEncrypt,
+}
+
+// ageEncrypt encrypts data to the age recipient (public key) with the age CLI, as ASCII armor
+func ageEncrypt(recipient string, data []byte) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("age", "--armor", "--recipient", recipient)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("age encryption failed, %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// validateEncryptTo checks that target is a <scheme>:<recipient> pair with a known scheme
+func validateEncryptTo(target string) error {
+	scheme, recipient, ok := strings.Cut(target, ":")
+	if _, known := outputEncryptors[scheme]; ok && known && recipient != "" {
+		return nil
+	}
+	schemes := make([]string, 0, len(outputEncryptors))
+	for name := range outputEncryptors {
+		schemes = append(schemes, name+":<recipient>")
+	}
+	sort.Strings(schemes)
+	return fmt.Errorf("invalid -encrypt-to %q, expected one of: %s", target, strings.Join(schemes, ", "))
+}
+
+// encryptOutput encrypts data for target, which is a <scheme>:<recipient> pair
+func encryptOutput(target string, data []byte) ([]byte, error) {
+	if err := validateEncryptTo(target); err != nil {
+		return nil, err
+	}
+	scheme, recipient, _ := strings.Cut(target, ":")
+	return outputEncryptors[scheme](recipient, data)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// exitCodeExpired is the exit status when the only credentials available are expired,
+// so callers can tell it apart from other failures
+const exitCodeExpired = 3
+
+// minValidity is how long credentials must remain valid to be used, set with -min-validity
+var minValidity time.Duration
+
+// expiresSoon reports whether the credentials expire within -min-validity
+func expiresSoon(creds aws.Credentials) bool {
+	return creds.CanExpire && time.Until(creds.Expires) < minValidity
+}
+
+// expiryWindow is how long before they expire credentials are refreshed ahead of time,
+// set with -expiry-window
+var expiryWindow time.Duration
+
+// notifyBefore is how long before they expire a desktop notification is shown for
+// credentials held by -watch and sudo, set with -notify-before
+var notifyBefore time.Duration
+
+// maxStale is how long past expiring cached credentials may still be used when they can't
+// be refreshed, set with -max-stale
+var maxStale time.Duration
+
+// refreshDue reports whether cached credentials expire within -expiry-window or
+// -min-validity, so they should be refreshed rather than used
+func refreshDue(creds aws.Credentials) bool {
+	return expiresSoon(creds) || (creds.CanExpire && time.Until(creds.Expires) < expiryWindow)
+}
+
+// expiredCredentialsError is returned instead of credentials that expire within
+// -min-validity, e.g. from a corrupt or raced cache entry, so they are never written out
+type expiredCredentialsError struct {
+	expires time.Time
+}
+
+func (e *expiredCredentialsError) Error() string {
+	if time.Now().After(e.expires) {
+		return fmt.Sprintf("credentials expired at %s", e.expires.Local().Format(time.RFC1123))
+	}
+	return fmt.Sprintf("credentials expire at %s, within -min-validity of %s", e.expires.Local().Format(time.RFC1123), minValidity)
+}
+
+// checkExpiration is the final check before credentials are used
+func checkExpiration(creds aws.Credentials) error {
+	if expiresSoon(creds) {
+		return &expiredCredentialsError{expires: creds.Expires}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "explain",
+		usage: "show how credentials would be resolved for the credential flags, without retrieving any or prompting for MFA",
+		run:   runExplain,
+	})
+}
+
+func runExplain(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	addCredentialFlags(fs)
+	fs.Parse(args)
+
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	line := func(label, format string, a ...any) {
+		fmt.Fprintf(w, "%s:\t%s\n", label, fmt.Sprintf(format, a...))
+	}
+
+	line("profile", "%s", profileOrDefault())
+	switch {
+	case src.cacheKey.IdentityPoolId != "":
+		line("source", "cognito identity pool %s", src.cacheKey.IdentityPoolId)
+	case src.cacheKey.RoleArn != "":
+		line("source", "assume role %s", src.cacheKey.RoleArn)
+	default:
+		line("source", "profile credentials, without assuming a role")
+	}
+	if src.cacheKey.SerialNumber != "" {
+		line("mfa device", "%s", src.cacheKey.SerialNumber)
+	}
+	if src.cacheKey.PolicyHash != "" {
+		line("session policy", "%s (sha256 %s)", sessionPolicyFile, src.cacheKey.PolicyHash)
+	}
+
+	if imdsDisabled() {
+		line("metadata fallbacks", "disabled")
+	} else {
+		line("metadata fallbacks", "enabled")
+	}
+
+	line("region", "%s (from %s)", src.region, src.regionSource)
+
+	names, err := pipeline()
+	if err != nil {
+		return err
+	}
+	line("pipeline", "%s", strings.Join(names, " -> "))
+	for i, name := range names {
+		line(fmt.Sprintf("  %d. %s", i+1, name), "%s", describeStage(name))
+	}
+
+	if noCache {
+		line("cache", "disabled")
+	} else {
+		cache := src.cache()
+		creds, err := cache.get()
+		switch {
+		case err != nil:
+			line("cache", "%s (empty)", cache.location())
+		case creds.Expired():
+			line("cache", "%s (expired)", cache.location())
+		default:
+			line("cache", "%s (valid until %s)", cache.location(), creds.Expires.Local().Format(time.RFC1123))
+		}
+	}
+
+	return w.Flush()
+}
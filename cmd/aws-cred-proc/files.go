@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ryandeivert/aws-cred-proc/internal/fileutil"
+)
+
+// fileMode is the permission mode of every file this tool writes (caches, generated
+// configs, etc). Directories it creates get the same mode, plus search permission
+var fileMode os.FileMode = 0600
+
+// fileModeFlag is a flag.Value for an octal permission mode, e.g. 0640
+type fileModeFlag struct {
+	mode *os.FileMode
+}
+
+func (f fileModeFlag) String() string {
+	if f.mode == nil {
+		return ""
+	}
+	return fmt.Sprintf("%04o", uint32(*f.mode))
+}
+
+func (f fileModeFlag) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode&^0777 != 0 {
+		return fmt.Errorf("invalid file mode %q, expected octal permissions like 0600", value)
+	}
+	// Every file written has to be read back and updated by its owner
+	if mode&0600 != 0600 {
+		return fmt.Errorf("invalid file mode %q, the owner needs read and write permission (0600)", value)
+	}
+	*f.mode = os.FileMode(mode)
+	return nil
+}
+
+// dirMode is fileMode with the execute (search) bit added wherever the read bit is set
+func dirMode() os.FileMode {
+	return fileutil.DirMode(fileMode)
+}
+
+// writeFile writes data to path with fileMode, regardless of the umask or the mode
+// of an existing file, and verifies the resulting permissions
+func writeFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, fileMode); err != nil {
+		return err
+	}
+	return enforceFileMode(path)
+}
+
+// writeFileAtomic is writeFile through a temporary file in the same directory that is
+// renamed over path, so readers never see a partially written file. The file is synced
+// before the rename, so a crash can't leave path truncated either
+func writeFileAtomic(path string, data []byte) error {
+	return writeFileRenamed(path, data, true)
+}
+
+// writeFileRenamed is writeFileAtomic, only syncing when sync is set. Files that can
+// be lost in a crash, like the usage stats, skip the cost of the syncs
+func writeFileRenamed(path string, data []byte, sync bool) error {
+	return fileutil.WriteAtomic(path, data, fileMode, sync)
+}
+
+// makeDirs creates path and any missing parents with dirMode
+func makeDirs(path string) error {
+	return fileutil.MakeDirs(path, fileMode)
+}
+
+// enforceFileMode sets fileMode on a file, which may have been written by another
+// program, and verifies the permissions took effect
+func enforceFileMode(path string) error {
+	return fileutil.EnforceMode(path, fileMode)
+}
+
+// shredFile overwrites the file's contents with random data, flushing it to disk,
+// before removing it
+func shredFile(path string) error {
+	return fileutil.Shred(path)
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// isPipe reports whether f is a pipe, as when another process reads the output
+func isPipe(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
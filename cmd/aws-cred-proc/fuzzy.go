@@ -0,0 +1,168 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-tty"
+)
+
+// fuzzyPickRows is the most matches shown at once, scrolling through the rest
+const fuzzyPickRows = 10
+
+var errPickCancelled = errors.New("no selection made")
+
+// fuzzyScore returns how well query matches s, ignoring case, or -1 if it doesn't. The
+// query's characters must appear in s in order, and score higher when adjacent or at the
+// start of a word, so "prdadm" ranks prod-admin above production-readonly-admin
+func fuzzyScore(query, s string) int {
+	q := []rune(strings.ToLower(query))
+	if len(q) == 0 {
+		return 0
+	}
+	score, matched, prev := 0, 0, -2
+	runes := []rune(strings.ToLower(s))
+	for i, r := range runes {
+		if r != q[matched] {
+			continue
+		}
+		score++
+		if i == prev+1 {
+			score += 2
+		}
+		if i == 0 || !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]) {
+			score += 3
+		}
+		prev = i
+		if matched++; matched == len(q) {
+			return score
+		}
+	}
+	return -1
+}
+
+// fuzzyFilter returns the indexes of the items matching query, best first and otherwise
+// in their original order
+func fuzzyFilter(query string, items []string) []int {
+	var matches []int
+	scores := map[int]int{}
+	for i, item := range items {
+		if score := fuzzyScore(query, item); score >= 0 {
+			matches = append(matches, i)
+			scores[i] = score
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return scores[matches[i]] > scores[matches[j]] })
+	return matches
+}
+
+// fuzzyPick lets the user narrow the items down by typing on the terminal and choose one
+// with the arrow keys and enter, starting on def. It returns the index of the chosen
+// item, or errPickCancelled on escape
+func fuzzyPick(prompt string, items []string, def int) (int, error) {
+	t, err := tty.Open()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open tty, %w", err)
+	}
+	defer t.Close()
+	defer onAbort(func() { t.Close() })()
+	out := t.Output()
+
+	width := 80
+	if w, _, err := t.Size(); err == nil && w > 4 {
+		width = w
+	}
+
+	var query []rune
+	matches := fuzzyFilter("", items)
+	selected, offset := def, 0
+	for {
+		if selected >= len(matches) {
+			selected = len(matches) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+		if selected < offset {
+			offset = selected
+		}
+		if selected >= offset+fuzzyPickRows {
+			offset = selected - fuzzyPickRows + 1
+		}
+
+		// Redraw the list below the prompt line, then return the cursor to the query
+		rows := matches[offset:min(offset+fuzzyPickRows, len(matches))]
+		fmt.Fprintf(out, "\r\x1b[J%s> %s", prompt, string(query))
+		for i, item := range rows {
+			marker := "  "
+			if offset+i == selected {
+				marker = "> "
+			}
+			fmt.Fprintf(out, "\n\r%s%s", marker, truncateRunes(items[item], width-3))
+		}
+		fmt.Fprintf(out, "\n\r  %d/%d", len(matches), len(items))
+		fmt.Fprintf(out, "\x1b[%dA\r\x1b[%dC", len(rows)+1, len([]rune(prompt))+2+len(query))
+
+		r, err := t.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		switch r {
+		case '\r', '\n':
+			if len(matches) == 0 {
+				continue
+			}
+			fmt.Fprintf(out, "\r\x1b[J%s: %s\n", prompt, items[matches[selected]])
+			return matches[selected], nil
+		case 0x1b:
+			// Arrow keys arrive as escape sequences, and a lone escape cancels
+			if !t.Buffered() {
+				fmt.Fprint(out, "\r\x1b[J")
+				return 0, errPickCancelled
+			}
+			if next, _ := t.ReadRune(); next != '[' {
+				continue
+			}
+			switch key, _ := t.ReadRune(); key {
+			case 'A':
+				selected--
+			case 'B':
+				selected++
+			}
+		case 0x03, 0x04: // ctrl-c and ctrl-d, when they don't signal the process
+			fmt.Fprint(out, "\r\x1b[J")
+			return 0, errPickCancelled
+		case 0x10: // ctrl-p
+			selected--
+		case 0x0e, '\t': // ctrl-n
+			selected++
+		case 0x7f, 0x08:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				matches, selected, offset = fuzzyFilter(string(query), items), 0, 0
+			}
+		case 0x15: // ctrl-u
+			query = nil
+			matches, selected, offset = fuzzyFilter("", items), 0, 0
+		default:
+			if unicode.IsPrint(r) {
+				query = append(query, r)
+				matches, selected, offset = fuzzyFilter(string(query), items), 0, 0
+			}
+		}
+	}
+}
+
+// truncateRunes shortens s to at most n runes, marking it with an ellipsis if it was
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
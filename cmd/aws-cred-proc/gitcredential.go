@@ -0,0 +1,115 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "git-credential",
+		usage: "act as a git credential helper for CodeCommit HTTPS repositories, signing git requests with the profile's session, e.g. git config credential.helper '!aws-cred-proc git-credential -p dev'",
+		run:   runGitCredential,
+	})
+}
+
+// codeCommitHost matches CodeCommit git endpoints, including FIPS and VPC endpoints,
+// and captures the region
+var codeCommitHost = regexp.MustCompile(`(?:^|\.)git-codecommit(?:-fips)?\.([a-z0-9-]+)\.(?:vpce\.)?amazonaws\.com(?:\.cn)?$`)
+
+// readGitCredentialRequest reads the key=value lines git writes, up to a blank line
+func readGitCredentialRequest(r io.Reader) (map[string]string, error) {
+	request := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			request[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read git credential request, %w", err)
+	}
+	return request, nil
+}
+
+// codeCommitPassword signs the git request the same way the aws CLI's credential
+// helper does: SigV4 over a canonical request with the GIT method and only the host
+// header, returned as <timestamp>Z<signature>
+func codeCommitPassword(creds aws.Credentials, region, host, path string, now time.Time) string {
+	timestamp := now.UTC().Format("20060102T150405")
+	date := timestamp[:8]
+	scope := fmt.Sprintf("%s/%s/codecommit/aws4_request", date, region)
+
+	canonical := fmt.Sprintf("GIT\n%s\n\nhost:%s\n\nhost\n", path, host)
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", timestamp, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, "codecommit", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return timestamp + "Z" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func runGitCredential(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	addCredentialFlags(fs)
+	fs.Parse(args)
+
+	// git also sends store and erase, which have nothing to do since sessions are
+	// cached (and refreshed) the usual way
+	if fs.Arg(0) != "get" {
+		return nil
+	}
+
+	request, err := readGitCredentialRequest(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	// Answer nothing for other hosts, so git moves on to the next helper without
+	// anything being resolved (or an MFA prompt)
+	host, _, _ := strings.Cut(request["host"], ":") // the port is not signed
+	match := codeCommitHost.FindStringSubmatch(host)
+	if request["protocol"] != "https" || match == nil {
+		return nil
+	}
+
+	creds, _, err := resolveCredentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	username := creds.AccessKeyID
+	if creds.SessionToken != "" {
+		username += "%" + creds.SessionToken
+	}
+	path := "/" + strings.TrimPrefix(request["path"], "/")
+	password := codeCommitPassword(creds, match[1], host, path, time.Now())
+
+	_, err = fmt.Fprintf(os.Stdout, "username=%s\npassword=%s\n", username, password)
+	return err
+}
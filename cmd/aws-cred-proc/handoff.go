@@ -0,0 +1,198 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/ryandeivert/aws-cred-proc/pkg/cache"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "handoff",
+		usage: "move a session to another machine without redoing MFA, using a one-time age key. Subcommands: accept (on the receiving machine, run first), create (on the sending machine)",
+		run:   runHandoff,
+	})
+}
+
+const (
+	handoffVersion  = 1
+	ageArmorFooter  = "-----END AGE ENCRYPTED FILE-----"
+	agePublicKeyTag = "# public key: "
+)
+
+// handoffBundle is the payload encrypted to the receiving machine's one-time key
+type handoffBundle struct {
+	Version     int
+	Profile     string
+	NotAfter    time.Time // the bundle can't be accepted after this, regardless of the credentials' expiration
+	Credentials *cache.Credentials
+}
+
+func runHandoff(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageTo  = "the age recipient (public key) printed by handoff accept on the receiving machine (create only)"
+		usageTTL = "how long the bundle may be accepted for once created (create only)"
+	)
+	var to string
+	var ttl time.Duration
+
+	addCredentialFlags(fs)
+	fs.StringVar(&to, "to", "", usageTo)
+	fs.DurationVar(&ttl, "ttl", 5*time.Minute, usageTTL)
+
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("handoff requires one of: accept, create")
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	switch action {
+	case "create":
+		if to == "" {
+			return fmt.Errorf("handoff create requires -to")
+		}
+		return handoffCreate(ctx, to, ttl)
+	case "accept":
+		return handoffAccept(ctx)
+	default:
+		return fmt.Errorf("unknown handoff subcommand %q", action)
+	}
+}
+
+func handoffCreate(ctx context.Context, recipient string, ttl time.Duration) error {
+	creds, _, err := resolveCredentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	bundle := handoffBundle{
+		Version:     handoffVersion,
+		Profile:     profileOrDefault(),
+		NotAfter:    time.Now().Add(ttl).UTC(),
+		Credentials: cache.NewItem(creds).Credentials,
+	}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return fmt.Errorf("failed to encode handoff bundle, %w", err)
+	}
+
+	armored, err := ageEncrypt(recipient, data)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(armored)
+	return err
+}
+
+func handoffAccept(ctx context.Context) error {
+	// Compute where the session will be cached before doing anything else,
+	// so a misconfigured profile is caught before the other machine is involved
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	identity, err := exec.Command("age-keygen").Output()
+	if err != nil {
+		return fmt.Errorf("age-keygen failed, %w", err)
+	}
+
+	var recipient string
+	for _, line := range strings.Split(string(identity), "\n") {
+		if strings.HasPrefix(line, agePublicKeyTag) {
+			recipient = strings.TrimPrefix(line, agePublicKeyTag)
+		}
+	}
+	if recipient == "" {
+		return fmt.Errorf("failed to read public key from age-keygen output")
+	}
+
+	// The identity only ever exists in this temporary file, and only until this returns
+	identityFile, err := os.CreateTemp("", "aws-cred-proc-handoff-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(identityFile.Name())
+	if _, err := identityFile.Write(identity); err != nil {
+		identityFile.Close()
+		return fmt.Errorf("failed to write one-time identity, %w", err)
+	}
+	identityFile.Close()
+
+	fmt.Fprintf(os.Stderr, "On the sending machine, run:\n\n  aws-cred-proc handoff create --profile %s --to %s\n\n", profileOrDefault(), recipient)
+	fmt.Fprintln(os.Stderr, "Then paste the output here:")
+
+	armored, err := readAgeArmor(bufio.NewReader(os.Stdin))
+	if err != nil {
+		return err
+	}
+
+	var plaintext bytes.Buffer
+	cmd := exec.Command("age", "--decrypt", "--identity", identityFile.Name())
+	cmd.Stdin = strings.NewReader(armored)
+	cmd.Stdout = &plaintext
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("age decryption failed, %w", err)
+	}
+
+	var bundle handoffBundle
+	if err := json.Unmarshal(plaintext.Bytes(), &bundle); err != nil {
+		return fmt.Errorf("failed to decode handoff bundle, %w", err)
+	}
+	if bundle.Version != handoffVersion || bundle.Credentials == nil {
+		return fmt.Errorf("unsupported handoff bundle")
+	}
+	if time.Now().After(bundle.NotAfter) {
+		return fmt.Errorf("handoff bundle expired at %s", bundle.NotAfter.Local().Format(time.RFC1123))
+	}
+	if bundle.Profile != profileOrDefault() {
+		log.Printf("warning: bundle was created for profile %q, storing it for %q", bundle.Profile, profileOrDefault())
+	}
+
+	creds := aws.Credentials{
+		AccessKeyID:     bundle.Credentials.AccessKeyId,
+		SecretAccessKey: bundle.Credentials.SecretAccessKey,
+		SessionToken:    bundle.Credentials.SessionToken,
+		CanExpire:       true,
+		Expires:         time.Time(bundle.Credentials.Expiration),
+	}
+	if creds.Expired() {
+		return fmt.Errorf("handed off credentials have already expired")
+	}
+
+	if err := NewCache(src.provider, false, dpapiCache, src.cacheKey).save(creds); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Session for %q cached until %s\n", profileOrDefault(), creds.Expires.Local().Format(time.RFC1123))
+	return nil
+}
+
+// readAgeArmor reads lines until the end of an ASCII armored age file
+func readAgeArmor(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		b.WriteString(line)
+		if strings.TrimSpace(line) == ageArmorFooter {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read handoff bundle, %w", err)
+		}
+	}
+}
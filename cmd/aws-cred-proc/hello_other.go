@@ -0,0 +1,9 @@
+//go:build !windows && !credproc_min
+
+package main
+
+import "fmt"
+
+func helloVerify(profile string) error {
+	return fmt.Errorf("windows hello verification is only available on Windows")
+}
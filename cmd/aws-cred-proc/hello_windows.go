@@ -0,0 +1,43 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The UserConsentVerifier WinRT API is driven through PowerShell, which avoids cgo
+// and WinRT bindings. AsTask is needed to wait on the async operation
+const helloScript = `
+Add-Type -AssemblyName System.Runtime.WindowsRuntime
+$asTask = [System.WindowsRuntimeSystemExtensions].GetMethods() | Where-Object {
+	$_.Name -eq 'AsTask' -and $_.GetParameters().Count -eq 1 -and $_.GetParameters()[0].ParameterType.Name -eq 'IAsyncOperation` + "`" + `1'
+} | Select-Object -First 1
+$null = [Windows.Security.Credentials.UI.UserConsentVerifier, Windows.Security.Credentials.UI, ContentType=WindowsRuntime]
+$op = [Windows.Security.Credentials.UI.UserConsentVerifier]::RequestVerificationAsync($env:AWS_CRED_PROC_HELLO_MESSAGE)
+$task = $asTask.MakeGenericMethod([Windows.Security.Credentials.UI.UserConsentVerificationResult]).Invoke($null, @($op))
+$null = $task.Wait(-1)
+$task.Result
+`
+
+// helloVerify requires the user to verify their identity with Windows Hello
+// (face, fingerprint or PIN) before credentials for the profile are released
+func helloVerify(profile string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", helloScript)
+	cmd.Env = append(cmd.Environ(), fmt.Sprintf("AWS_CRED_PROC_HELLO_MESSAGE=Release AWS credentials for %s", profile))
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("windows hello verification failed, %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// UserConsentVerificationResult is Verified on success, or the reason it failed
+	if result := strings.TrimSpace(string(out)); result != "Verified" {
+		return fmt.Errorf("windows hello verification was not completed: %s", result)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "import",
+		usage: "migrate credentials from another tool. Sources: aws-vault (copy the keys it stores to the shared credentials file, and with -sessions its role sessions to the cache)",
+		run:   runImport,
+	})
+}
+
+func runImport(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageSessions = "also import the sessions of the role profiles in the config file. aws-vault prompts for MFA for a role it has no session cached for"
+		usageForce    = "overwrite keys that are already in the shared credentials file"
+	)
+	var sessions, force bool
+
+	fs.BoolVar(&sessions, "sessions", false, usageSessions)
+	fs.BoolVar(&force, "force", false, usageForce)
+
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("import requires a source: aws-vault")
+	}
+	source := args[0]
+	fs.Parse(args[1:])
+
+	switch source {
+	case "aws-vault":
+		if err := importAWSVaultKeys(force); err != nil {
+			return err
+		}
+		if sessions {
+			return importAWSVaultSessions(ctx)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown import source %q", source)
+	}
+}
+
+// awsVault runs the aws-vault CLI, which reads its keyring whichever backend it uses. Its
+// prompts, for the keyring password or an MFA token, are passed through to the terminal
+func awsVault(args ...string) ([]byte, error) {
+	cmd := exec.Command("aws-vault", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("aws-vault %s failed, %w", strings.Join(args, " "), err)
+	}
+	return out, nil
+}
+
+// importAWSVaultKeys copies the long-term keys aws-vault stores for each profile to the
+// section of the shared credentials file with the same name
+func importAWSVaultKeys(force bool) error {
+	out, err := awsVault("list", "--credentials")
+	if err != nil {
+		return err
+	}
+
+	path := sharedCredentialsPath()
+	file, err := loadINI(path)
+	if err != nil {
+		return err
+	}
+
+	imported := 0
+	for _, name := range strings.Fields(string(out)) {
+		if _, ok := file.get(name, "aws_access_key_id"); ok && !force {
+			fmt.Fprintf(os.Stderr, "Skipping %q, which already has keys in %s. Use -force to overwrite them\n", name, path)
+			continue
+		}
+
+		// Without a session, aws-vault exports the stored keys as they are
+		data, err := awsVault("export", "--no-session", "--format=json", name)
+		if err != nil {
+			return err
+		}
+		var keys importedSession
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return fmt.Errorf("failed to decode the keys of %q, %w", name, err)
+		}
+		if keys.AccessKeyId == "" || keys.SecretAccessKey == "" {
+			return fmt.Errorf("aws-vault exported no keys for %q", name)
+		}
+
+		file.set(name, "aws_access_key_id", keys.AccessKeyId)
+		file.set(name, "aws_secret_access_key", keys.SecretAccessKey)
+		imported++
+	}
+
+	if imported > 0 {
+		if err := writeFileAtomic(path, file.bytes()); err != nil {
+			return fmt.Errorf("failed to write %s, %w", path, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Imported the keys of %d profiles to %s\n", imported, path)
+	return nil
+}
+
+// importAWSVaultSessions caches aws-vault's session for each role profile, the same way
+// import-session would. A profile that fails is reported and skipped
+func importAWSVaultSessions(ctx context.Context) error {
+	config, err := loadINI(sharedConfigPath())
+	if err != nil {
+		return err
+	}
+
+	imported := 0
+	for _, section := range config.sections() {
+		if v, _ := config.get(section, "role_arn"); v == "" {
+			continue
+		}
+		name := profileFromSection(section)
+		if err := importAWSVaultSession(ctx, name); err != nil {
+			log.Printf("warning: failed to import the session of %q, %v", name, err)
+			continue
+		}
+		imported++
+	}
+	fmt.Fprintf(os.Stderr, "Imported the sessions of %d profiles to the cache\n", imported)
+	return nil
+}
+
+func importAWSVaultSession(ctx context.Context, name string) error {
+	data, err := awsVault("export", "--format=json", name)
+	if err != nil {
+		return err
+	}
+	creds, err := parseImportedSession(data)
+	if err != nil {
+		return err
+	}
+
+	profile = name
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	event := auditEvent{Action: "import-session", Profile: name, RoleArn: src.cacheKey.RoleArn}
+	if err := audit(event); err != nil {
+		return err
+	}
+	return NewCache(src.provider, false, dpapiCache, src.cacheKey).save(creds)
+}
@@ -0,0 +1,159 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "import-session",
+		usage: "store a session obtained elsewhere (e.g. from aws configure export-credentials --format process) in the cache for the profile, so it is served like one minted here",
+		run:   runImportSession,
+	})
+}
+
+// importedSession accepts the credential_process format, and the aws CLI cache format
+// which nests the same fields under Credentials
+type importedSession struct {
+	Version         int
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      *time.Time
+	Credentials     *importedSession
+}
+
+func runImportSession(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageFromJSON = "the `file` with the session, in the credential_process or aws CLI cache format. - reads stdin (required)"
+		usageNoVerify = "do not check with sts:GetCallerIdentity that the session belongs to the profile's role"
+	)
+	var fromJSON string
+	var noVerify bool
+
+	addCredentialFlags(fs)
+	fs.StringVar(&fromJSON, "from-json", "", usageFromJSON)
+	fs.BoolVar(&noVerify, "no-verify", false, usageNoVerify)
+	fs.Parse(args)
+
+	if fromJSON == "" {
+		return fmt.Errorf("import-session requires -from-json")
+	}
+	if noCache {
+		return fmt.Errorf("import-session stores the session in the cache, and can't be used with -no-cache")
+	}
+
+	// The session is stored under the same key the profile and flags resolve to,
+	// so it is what a credential_process with the same flags would use
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	creds, err := readImportedSession(fromJSON)
+	if err != nil {
+		return err
+	}
+
+	if !noVerify {
+		if err := verifyImportedSession(ctx, src, creds); err != nil {
+			return err
+		}
+	}
+
+	event := auditEvent{Action: "import-session", Profile: profileOrDefault(), RoleArn: src.cacheKey.RoleArn}
+	if err := audit(event); err != nil {
+		return err
+	}
+
+	if err := NewCache(src.provider, false, dpapiCache, src.cacheKey).save(creds); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Session for %q cached until %s\n", profileOrDefault(), creds.Expires.Local().Format(time.RFC1123))
+	return nil
+}
+
+func readImportedSession(path string) (aws.Credentials, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("failed to read session, %w", err)
+	}
+	return parseImportedSession(data)
+}
+
+func parseImportedSession(data []byte) (aws.Credentials, error) {
+	var session importedSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return aws.Credentials{}, fmt.Errorf("failed to decode session json, %w", err)
+	}
+	if session.Credentials != nil {
+		session = *session.Credentials
+	}
+
+	switch {
+	case session.Version > 1:
+		return aws.Credentials{}, fmt.Errorf("unsupported session version %d", session.Version)
+	case session.AccessKeyId == "" || session.SecretAccessKey == "":
+		return aws.Credentials{}, fmt.Errorf("session is missing AccessKeyId or SecretAccessKey")
+	case session.SessionToken == "" || session.Expiration == nil:
+		// Long-term keys belong in the credentials file, not the cache
+		return aws.Credentials{}, fmt.Errorf("session is missing SessionToken or Expiration, only temporary credentials can be imported")
+	}
+
+	creds := aws.Credentials{
+		AccessKeyID:     session.AccessKeyId,
+		SecretAccessKey: session.SecretAccessKey,
+		SessionToken:    session.SessionToken,
+		CanExpire:       true,
+		Expires:         session.Expiration.UTC(),
+	}
+	if creds.Expired() {
+		return aws.Credentials{}, fmt.Errorf("session expired at %s", creds.Expires.Local().Format(time.RFC1123))
+	}
+	return creds, nil
+}
+
+// verifyImportedSession checks that the session works, and that it is for the
+// profile's role when there is one
+func verifyImportedSession(ctx context.Context, src *credentialSource, creds aws.Credentials) error {
+	client := sts.New(sts.Options{
+		Credentials: credentials.StaticCredentialsProvider{Value: creds},
+		Region:      src.region,
+	}, withSTSOptions)
+	out, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("failed to verify session, %w", err)
+	}
+
+	role, err := arn.Parse(src.cacheKey.RoleArn)
+	if err != nil {
+		return nil // nothing more to compare against
+	}
+	// Sessions of the role have ARNs like arn:aws:sts::<account>:assumed-role/<name>/<session>
+	roleName := role.Resource[strings.LastIndex(role.Resource, "/")+1:]
+	caller, err := arn.Parse(aws.ToString(out.Arn))
+	if err != nil || caller.AccountID != role.AccountID || !strings.HasPrefix(caller.Resource, "assumed-role/"+roleName+"/") {
+		return fmt.Errorf("session belongs to %s, not the profile's role %s. Use -no-verify to import it anyway", aws.ToString(out.Arn), src.cacheKey.RoleArn)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// iniFile is a minimal reader/writer for the aws shared config and credentials
+// files. It keeps the original lines so that edits leave comments, ordering and
+// unrelated sections untouched
+type iniFile struct {
+	lines []string
+}
+
+// loadINI reads the file at path. A missing file is treated as empty
+func loadINI(path string) (*iniFile, error) {
+	f := &iniFile{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s, %w", path, err)
+	}
+	// An empty file has no lines, rather than one blank line the first section would follow
+	if content := strings.TrimRight(string(data), "\n"); content != "" {
+		f.lines = strings.Split(content, "\n")
+	}
+	return f, nil
+}
+
+// sharedConfigPath honors AWS_CONFIG_FILE the same way the SDK does
+func sharedConfigPath() string {
+	if v := os.Getenv("AWS_CONFIG_FILE"); v != "" {
+		return v
+	}
+	return config.DefaultSharedConfigFilename()
+}
+
+// sharedCredentialsPath honors AWS_SHARED_CREDENTIALS_FILE the same way the SDK does
+func sharedCredentialsPath() string {
+	if v := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); v != "" {
+		return v
+	}
+	return config.DefaultSharedCredentialsFilename()
+}
+
+// loadSharedProfile loads a profile with the SDK's parser. Unlike config.LoadSharedConfigProfile
+// on its own, the file locations from the environment are honored
+func loadSharedProfile(ctx context.Context, name string) (config.SharedConfig, error) {
+	return config.LoadSharedConfigProfile(ctx, name, func(o *config.LoadSharedConfigOptions) {
+		o.ConfigFiles = []string{sharedConfigPath()}
+		o.CredentialsFiles = []string{sharedCredentialsPath()}
+	})
+}
+
+// profileSetting reads a setting of the profile that is specific to this tool.
+// The SDK ignores settings it does not know about, so these can live alongside
+// the profile's other settings in the shared config file
+func profileSetting(key string) string {
+	cfg, err := loadINI(sharedConfigPath())
+	if err != nil {
+		return ""
+	}
+	value, _ := cfg.get(configSectionName(profileOrDefault()), key)
+	return value
+}
+
+// Profile settings that read secrets from a password store (pass or gopass) entry
+const (
+	passCredentialsSetting = "pass_credentials"
+	passTOTPSeedSetting    = "pass_totp_seed"
+	passCommandSetting     = "pass_command"
+)
+
+// mfaProcessSetting is the profile setting with the command that prints the MFA token,
+// like -mfa-process
+const mfaProcessSetting = "mfa_process"
+
+// configSectionName returns the ~/.aws/config section name for a profile,
+// which is prefixed with "profile " for everything but the default profile
+func configSectionName(profile string) string {
+	if profile == "default" {
+		return profile
+	}
+	return "profile " + profile
+}
+
+// profileFromSection is the inverse of configSectionName
+func profileFromSection(section string) string {
+	return strings.TrimPrefix(section, "profile ")
+}
+
+func parseSectionHeader(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+	return strings.TrimSpace(line[1 : len(line)-1]), true
+}
+
+func parseKeyValue(line string) (string, string, bool) {
+	if isBlankOrComment(line) {
+		return "", "", false
+	}
+	key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok {
+		return "", "", false
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(value), true
+}
+
+func isBlankOrComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";")
+}
+
+// sections returns the section names in the order they appear
+func (f *iniFile) sections() []string {
+	var names []string
+	for _, line := range f.lines {
+		if name, ok := parseSectionHeader(line); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// bounds returns the line index of the section header and the index
+// one past the section's last line, or -1 if the section does not exist
+func (f *iniFile) bounds(section string) (int, int) {
+	start := -1
+	for i, line := range f.lines {
+		name, ok := parseSectionHeader(line)
+		if !ok {
+			continue
+		}
+		if start >= 0 {
+			return start, i
+		}
+		if name == section {
+			start = i
+		}
+	}
+	if start < 0 {
+		return -1, -1
+	}
+	return start, len(f.lines)
+}
+
+// values returns all of the key/value pairs in the section
+func (f *iniFile) values(section string) map[string]string {
+	values := map[string]string{}
+	start, end := f.bounds(section)
+	if start < 0 {
+		return values
+	}
+	for _, line := range f.lines[start+1 : end] {
+		if key, value, ok := parseKeyValue(line); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// globalValues returns the key/value pairs before the first section header
+func (f *iniFile) globalValues() map[string]string {
+	values := map[string]string{}
+	for _, line := range f.lines {
+		if _, ok := parseSectionHeader(line); ok {
+			break
+		}
+		if key, value, ok := parseKeyValue(line); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+func (f *iniFile) get(section, key string) (string, bool) {
+	value, ok := f.values(section)[key]
+	return value, ok
+}
+
+// set updates the key in place if it exists, otherwise it is added to the end
+// of the section. The section is created if it does not exist
+func (f *iniFile) set(section, key, value string) {
+	line := fmt.Sprintf("%s = %s", key, value)
+	start, end := f.bounds(section)
+	if start < 0 {
+		if len(f.lines) > 0 && strings.TrimSpace(f.lines[len(f.lines)-1]) != "" {
+			f.lines = append(f.lines, "")
+		}
+		f.lines = append(f.lines, fmt.Sprintf("[%s]", section), line)
+		return
+	}
+
+	for i := start + 1; i < end; i++ {
+		if k, _, ok := parseKeyValue(f.lines[i]); ok && k == key {
+			f.lines[i] = line
+			return
+		}
+	}
+
+	// Insert after the section's last setting, so blank separators and any comments
+	// heading the next section stay with it
+	insert := end
+	for insert > start+1 && isBlankOrComment(f.lines[insert-1]) {
+		insert--
+	}
+	f.lines = append(f.lines[:insert], append([]string{line}, f.lines[insert:]...)...)
+}
+
+func (f *iniFile) bytes() []byte {
+	return []byte(strings.Join(f.lines, "\n") + "\n")
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// iniEdit is a set call to make on a loaded file
+type iniEdit struct {
+	section, key, value string
+}
+
+func loadTestINI(t *testing.T, content string) *iniFile {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := loadINI(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestINIRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		edits []iniEdit
+		want  string
+	}{
+		{
+			name: "unchanged",
+			input: `# managed by hand
+region = us-east-1
+
+[default]
+; the long-lived keys
+aws_access_key_id = AKIAOLD
+aws_secret_access_key=secret
+
+[profile dev]
+role_arn = arn:aws:iam::123456789012:role/Dev
+`,
+			want: `# managed by hand
+region = us-east-1
+
+[default]
+; the long-lived keys
+aws_access_key_id = AKIAOLD
+aws_secret_access_key=secret
+
+[profile dev]
+role_arn = arn:aws:iam::123456789012:role/Dev
+`,
+		},
+		{
+			name: "update in place keeps comments",
+			input: `[default]
+# rotated by rotate-keys
+aws_access_key_id = AKIAOLD
+aws_secret_access_key = old
+
+[other]
+aws_access_key_id = AKIAOTHER
+`,
+			edits: []iniEdit{
+				{"default", "aws_access_key_id", "AKIANEW"},
+				{"default", "aws_secret_access_key", "new"},
+			},
+			want: `[default]
+# rotated by rotate-keys
+aws_access_key_id = AKIANEW
+aws_secret_access_key = new
+
+[other]
+aws_access_key_id = AKIAOTHER
+`,
+		},
+		{
+			name: "commented out key is not replaced",
+			input: `[default]
+# aws_session_token = stale
+aws_access_key_id = AKIA
+`,
+			edits: []iniEdit{{"default", "aws_session_token", "tok"}},
+			want: `[default]
+# aws_session_token = stale
+aws_access_key_id = AKIA
+aws_session_token = tok
+`,
+		},
+		{
+			name: "added key goes before the blank separator",
+			input: `[profile a]
+region = us-east-1
+
+# b is for builds
+[profile b]
+region = us-west-2
+`,
+			edits: []iniEdit{{"profile a", "output", "json"}},
+			want: `[profile a]
+region = us-east-1
+output = json
+
+# b is for builds
+[profile b]
+region = us-west-2
+`,
+		},
+		{
+			name: "new section is separated by a blank line",
+			input: `[default]
+region = us-east-1
+`,
+			edits: []iniEdit{{"profile new", "role_arn", "arn:aws:iam::123456789012:role/New"}},
+			want: `[default]
+region = us-east-1
+
+[profile new]
+role_arn = arn:aws:iam::123456789012:role/New
+`,
+		},
+		{
+			name:  "empty file",
+			input: "",
+			edits: []iniEdit{{"default", "region", "eu-west-1"}},
+			want: `[default]
+region = eu-west-1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := loadTestINI(t, tt.input)
+			for _, edit := range tt.edits {
+				f.set(edit.section, edit.key, edit.value)
+			}
+			if got := string(f.bytes()); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestINIRead(t *testing.T) {
+	f := loadTestINI(t, `# global settings
+cli_pager =
+[default]
+region = us-east-1
+; region = eu-west-1
+# output = text
+[profile dev]
+role_arn=arn:aws:iam::123456789012:role/Dev
+  source_profile = default
+`)
+
+	if got, want := f.sections(), []string{"default", "profile dev"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sections() = %v, want %v", got, want)
+	}
+	if got, want := f.globalValues(), map[string]string{"cli_pager": ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("globalValues() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		section, key string
+		want         string
+		wantOK       bool
+	}{
+		{"default", "region", "us-east-1", true},
+		{"default", "output", "", false},
+		{"profile dev", "role_arn", "arn:aws:iam::123456789012:role/Dev", true},
+		{"profile dev", "source_profile", "default", true},
+		{"profile dev", "region", "", false},
+		{"profile missing", "region", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := f.get(tt.section, tt.key)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("get(%q, %q) = %q, %v, want %q, %v", tt.section, tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestLoadINIMissing(t *testing.T) {
+	f, err := loadINI(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.sections()) != 0 {
+		t.Errorf("sections() = %v, want none", f.sections())
+	}
+}
@@ -0,0 +1,70 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// keyringService is the service name items are stored under in the OS keyring
+const keyringService = "aws-cred-proc"
+
+// keyringTimeout bounds each call to a keyring CLI, which otherwise waits forever on an
+// unlock prompt nobody answers, or on a Secret Service that doesn't reply over D-Bus
+const keyringTimeout = time.Minute
+
+// keyringRetries is how many more times a call is made after a transient timeout
+const keyringRetries = 2
+
+var (
+	errKeyringNotFound = errors.New("item not found in keyring")
+	errKeyringLocked   = errors.New("the keyring is locked")
+	errKeyringDenied   = errors.New("access to the keyring was denied")
+	errKeyringTimeout  = errors.New("timed out waiting for the keyring")
+)
+
+// runKeyringCommand runs a keyring CLI and returns its stdout. Failures are passed to
+// classify along with the stderr, which maps them to the errors above, or returns nil
+// for anything else. A classified errKeyringTimeout, like D-Bus timing out while the
+// service starts, is retried, but not the command running out of keyringTimeout itself
+func runKeyringCommand(classify func(err error, stderr string) error, stdin string, name string, args ...string) (string, error) {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), keyringTimeout)
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stderr = &stderr
+		// Don't wait on the pipes when a child of the command, like a prompt, holds them
+		cmd.WaitDelay = time.Second
+		if stdin != "" {
+			cmd.Stdin = strings.NewReader(stdin)
+		}
+		out, err := cmd.Output()
+		timedOut := ctx.Err() != nil
+		cancel()
+
+		switch {
+		case err == nil:
+			return string(out), nil
+		case timedOut:
+			return "", fmt.Errorf("%w, %s did not finish within %s", errKeyringTimeout, name, keyringTimeout)
+		case errors.Is(err, exec.ErrNotFound):
+			return "", err
+		}
+		msg := strings.TrimSpace(stderr.String())
+		classified := classify(err, msg)
+		if classified == nil {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		if errors.Is(classified, errKeyringTimeout) && attempt < keyringRetries {
+			debugf("retrying %s, %s", name, msg)
+			continue
+		}
+		return "", classified
+	}
+}
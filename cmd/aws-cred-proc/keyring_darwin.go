@@ -0,0 +1,92 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The macOS login keychain is driven through the security CLI, which avoids cgo
+
+// keyringMaxSize is the most an item can hold, without a limit here
+const keyringMaxSize = 0
+
+func keyringGet(account string) (string, error) {
+	var out string
+	err := withUnlockedKeychain(func() (err error) {
+		out, err = runKeyringCommand(keychainError, "", "security", "find-generic-password", "-s", keyringService, "-a", account, "-w")
+		return err
+	})
+	if errors.Is(err, errKeyringNotFound) {
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read keychain item, %w", err)
+	}
+	return strings.TrimRight(out, "\n"), nil
+}
+
+func keyringSet(account, secret string) error {
+	// -U updates the item if it already exists. With -w last and no value, security
+	// prompts for the secret, and its retype, on stdin, which keeps it out of the
+	// process list
+	err := withUnlockedKeychain(func() error {
+		_, err := runKeyringCommand(keychainError, secret+"\n"+secret+"\n", "security", "add-generic-password", "-U", "-s", keyringService, "-a", account, "-w")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write keychain item, %w", err)
+	}
+	return nil
+}
+
+func keyringDelete(account string) error {
+	err := withUnlockedKeychain(func() error {
+		_, err := runKeyringCommand(keychainError, "", "security", "delete-generic-password", "-s", keyringService, "-a", account)
+		return err
+	})
+	if errors.Is(err, errKeyringNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete keychain item, %w", err)
+	}
+	return nil
+}
+
+// keychainError maps the failures of the security CLI to the typed keyring errors
+func keychainError(err error, stderr string) error {
+	switch {
+	case strings.Contains(stderr, "could not be found"):
+		return errKeyringNotFound
+	case strings.Contains(stderr, "User interaction is not allowed"):
+		// The keychain is locked and security can't show the unlock dialog, e.g. over ssh
+		return errKeyringLocked
+	case strings.Contains(stderr, "User canceled"):
+		return errKeyringDenied
+	}
+	return nil
+}
+
+// withUnlockedKeychain runs fn, and if the keychain is locked, unlocks it with its
+// password on the terminal before running fn again. Without a terminal the locked
+// error is returned with how to unlock it
+func withUnlockedKeychain(fn func() error) error {
+	err := fn()
+	if !errors.Is(err, errKeyringLocked) {
+		return err
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+		return fmt.Errorf("%w, unlock it with security unlock-keychain", err)
+	}
+	cmd := exec.Command("security", "unlock-keychain")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to unlock the keychain, %w", err)
+	}
+	return fn()
+}
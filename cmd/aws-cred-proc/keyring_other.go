@@ -0,0 +1,70 @@
+//go:build !darwin && !windows && !credproc_min
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service (GNOME Keyring, KWallet, etc) is driven through the
+// secret-tool CLI from libsecret, which avoids cgo and a D-Bus dependency
+
+// keyringMaxSize is the most an item can hold, without a limit here
+const keyringMaxSize = 0
+
+func keyringGet(account string) (string, error) {
+	out, err := runKeyringCommand(secretToolError, "", "secret-tool", "lookup", "service", keyringService, "account", account)
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("failed to run secret-tool, install libsecret-tools, %w", err)
+	}
+	if errors.Is(err, errKeyringNotFound) {
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read keyring item, %w", err)
+	}
+	return strings.TrimRight(out, "\n"), nil
+}
+
+func keyringSet(account, secret string) error {
+	label := fmt.Sprintf("%s (%s)", keyringService, account)
+	// The secret goes on stdin, which keeps it out of the process list
+	_, err := runKeyringCommand(secretToolError, secret, "secret-tool", "store", "--label", label, "service", keyringService, "account", account)
+	if err != nil {
+		return fmt.Errorf("failed to write keyring item, %w", err)
+	}
+	return nil
+}
+
+func keyringDelete(account string) error {
+	if _, err := keyringGet(account); err != nil {
+		return err
+	}
+	_, err := runKeyringCommand(secretToolError, "", "secret-tool", "clear", "service", keyringService, "account", account)
+	if err != nil {
+		return fmt.Errorf("failed to delete keyring item, %w", err)
+	}
+	return nil
+}
+
+// secretToolError maps the failures of secret-tool, which passes on libsecret's
+// messages, to the typed keyring errors
+func secretToolError(err error, stderr string) error {
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && stderr == "":
+		// secret-tool exits 1 without output when nothing matches
+		return errKeyringNotFound
+	case strings.Contains(stderr, "locked"):
+		return fmt.Errorf("%w, unlock the login keyring and try again", errKeyringLocked)
+	case strings.Contains(stderr, "dismissed"), strings.Contains(stderr, "cancelled"):
+		return errKeyringDenied
+	case strings.Contains(stderr, "Timeout was reached"):
+		// D-Bus gave up waiting, often while the Secret Service is starting
+		return errKeyringTimeout
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ryandeivert/aws-cred-proc/pkg/cache"
+)
+
+// keyringCacheBackend keeps entries in the OS keyring, so no credentials are left on
+// disk. The aws CLI doesn't read them from there. Entries larger than the keyring holds
+// are kept in the file backend instead, with a warning
+type keyringCacheBackend struct{}
+
+func newKeyringCacheBackend() (cache.Backend, error) {
+	return keyringCacheBackend{}, nil
+}
+
+// keyringCacheIndex is the keyring account listing the names of the entries, since
+// the keyrings can't list items by prefix themselves
+const keyringCacheIndex = "cache-index"
+
+// keyringCacheLockTimeout is how long updating the index waits for another process
+// updating it
+const keyringCacheLockTimeout = 5 * time.Second
+
+// keyringOverflow keeps the entries too large for the keyring, apart from the aws CLI's
+// entries so they're never read or removed in their place
+func keyringOverflow() cache.FileBackend {
+	return cache.FileBackend{Dir: filepath.Join(stateDir(), "keyring-overflow"), Mode: fileMode}
+}
+
+// keyringCacheAccount is the keyring account an entry is stored under
+func keyringCacheAccount(name string) string {
+	return "cache:" + name
+}
+
+func (b keyringCacheBackend) Get(name string) ([]byte, error) {
+	value, err := keyringGet(keyringCacheAccount(name))
+	if errors.Is(err, errKeyringNotFound) {
+		return keyringOverflow().Get(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Encrypted entries are binary, and keyring items are strings
+	return base64.StdEncoding.DecodeString(value)
+}
+
+func (b keyringCacheBackend) Put(name string, data []byte) error {
+	value := base64.StdEncoding.EncodeToString(data)
+	if keyringMaxSize > 0 && len(value) > keyringMaxSize {
+		log.Printf("warning: the cache entry is %d bytes, more than the %d the keyring holds, writing it to %s instead", len(value), keyringMaxSize, keyringOverflow().Location(name))
+		if err := keyringDelete(keyringCacheAccount(name)); err != nil && !errors.Is(err, errKeyringNotFound) {
+			return err
+		}
+		if err := keyringOverflow().Put(name, data); err != nil {
+			return err
+		}
+	} else {
+		if err := keyringSet(keyringCacheAccount(name), value); err != nil {
+			return err
+		}
+		// Don't leave credentials on disk from when an earlier entry didn't fit
+		if err := keyringOverflow().Delete(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return b.updateIndex(func(names []string) []string {
+		if slices.Contains(names, name) {
+			return names
+		}
+		return append(names, name)
+	})
+}
+
+func (b keyringCacheBackend) Delete(name string) error {
+	err := keyringDelete(keyringCacheAccount(name))
+	if err != nil && !errors.Is(err, errKeyringNotFound) {
+		return err
+	}
+	if errors.Is(err, errKeyringNotFound) {
+		err = keyringOverflow().Delete(name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if indexErr := b.updateIndex(func(names []string) []string {
+		return slices.DeleteFunc(names, func(n string) bool { return n == name })
+	}); indexErr != nil {
+		return indexErr
+	}
+	if err != nil {
+		return fmt.Errorf("no cache entry %s in the keyring, %w", name, os.ErrNotExist)
+	}
+	return nil
+}
+
+func (b keyringCacheBackend) List() ([]string, error) {
+	value, err := keyringGet(keyringCacheIndex)
+	if errors.Is(err, errKeyringNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(value), nil
+}
+
+func (b keyringCacheBackend) Location(name string) string {
+	if keyringMaxSize > 0 {
+		if _, err := os.Stat(keyringOverflow().Location(name)); err == nil {
+			return keyringOverflow().Location(name)
+		}
+	}
+	return fmt.Sprintf("keyring item %s", keyringCacheAccount(name))
+}
+
+// updateIndex rewrites the index with the names update returns, holding a lock so
+// processes writing entries at once don't lose each other's names
+func (b keyringCacheBackend) updateIndex(update func([]string) []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), keyringCacheLockTimeout)
+	defer cancel()
+	release, err := acquireSlot(ctx, "keyring-cache-index", 1)
+	if err != nil {
+		return fmt.Errorf("failed to lock the keyring cache index, %w", err)
+	}
+	defer release()
+
+	names, err := b.List()
+	if err != nil {
+		return err
+	}
+	return keyringSet(keyringCacheIndex, strings.Join(update(names), "\n"))
+}
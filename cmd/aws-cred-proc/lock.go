@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const lockPollInterval = 100 * time.Millisecond
+
+// acquireSlot blocks until one of slots lock files for name can be locked, limiting the
+// number of processes doing the same thing at once, and returns a function releasing it.
+// Locks are held by open files, so a process that dies never leaves one behind
+func acquireSlot(ctx context.Context, name string, slots int) (func(), error) {
+	dir := filepath.Join(stateDir(), "locks")
+	if err := makeDirs(dir); err != nil {
+		return nil, fmt.Errorf("failed to make directories, %w", err)
+	}
+
+	for {
+		for i := 0; i < slots; i++ {
+			path := filepath.Join(dir, fmt.Sprintf("%s.%d.lock", name, i))
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, fileMode)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open lock file, %w", err)
+			}
+			ok, err := tryLockFile(f)
+			if ok {
+				return func() { f.Close() }, nil
+			}
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to lock %s, %w", path, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// useTempHome moves the state directory somewhere the test can write, for the rest of it
+func useTempHome(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+}
+
+func TestAcquireSlot(t *testing.T) {
+	useTempHome(t)
+	acquire := func(timeout time.Duration) (func(), error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return acquireSlot(ctx, "test", 2)
+	}
+
+	first, err := acquire(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := acquire(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second()
+
+	// Both slots are taken, so the next caller waits until it gives up
+	if _, err := acquire(3 * lockPollInterval); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquired a third of 2 slots, %v", err)
+	}
+
+	// And gets the slot once it's released
+	go func() {
+		time.Sleep(lockPollInterval)
+		first()
+	}()
+	third, err := acquire(time.Second)
+	if err != nil {
+		t.Fatalf("the released slot wasn't acquired, %v", err)
+	}
+	third()
+}
+
+// Slots of different names don't wait for each other
+func TestAcquireSlotNames(t *testing.T) {
+	useTempHome(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	release, err := acquireSlot(ctx, "refresh-a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	other, err := acquireSlot(ctx, "refresh-b", 1)
+	if err != nil {
+		t.Fatalf("a slot of another name waited, %v", err)
+	}
+	other()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Formats of -log-format
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logRedacted replaces secrets in log messages
+const logRedacted = "[REDACTED]"
+
+var (
+	logFormat string
+	logFile   string
+
+	// loggingConfigured is set once setupLogging has installed the log output, which is
+	// only done once even though the flags may be checked more than once
+	loggingConfigured bool
+)
+
+var (
+	// Values of settings and fields whose names mark them as secret, e.g. aws_secret_access_key=...
+	// or "SessionToken": "...". The name is kept so the message still makes sense
+	secretFieldPattern = regexp.MustCompile(`(?i)((?:secret|token|password|passphrase|session_?key)[a-z_]*"?\s*[:=]\s*"?)[^\s",}]+`)
+	// JWTs, e.g. web identity and OIDC tokens
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// Runs of base64 long enough to be a secret access key or a session token
+	base64Pattern = regexp.MustCompile(`[A-Za-z0-9/+=]{40,}`)
+)
+
+// redactSecrets replaces anything that looks like a secret in a log message, in case an
+// error from the SDK or another program includes one
+func redactSecrets(msg string) string {
+	msg = secretFieldPattern.ReplaceAllString(msg, "${1}"+logRedacted)
+	msg = jwtPattern.ReplaceAllString(msg, logRedacted)
+	return base64Pattern.ReplaceAllStringFunc(msg, func(s string) string {
+		// Session tokens are hundreds of characters long, and secret access keys 40 random
+		// characters. Hex digests of the same length, like cache keys, are left alone
+		if len(s) >= 100 || (len(s) == 40 && strings.IndexFunc(s, unicode.IsUpper) >= 0 &&
+			strings.IndexFunc(s, unicode.IsLower) >= 0 && strings.IndexFunc(s, unicode.IsDigit) >= 0) {
+			return logRedacted
+		}
+		return s
+	})
+}
+
+// logEntry is a line of -log-format json
+type logEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Msg     string `json:"msg"`
+	Profile string `json:"profile"`
+}
+
+// logWriter is the output of the log package once setupLogging has run. It redacts
+// secrets from every message, and with -log-format json writes each as a JSON object on
+// its own line. Debug messages and warnings are prefixed with their level, and anything
+// else logged is an error
+type logWriter struct {
+	out  io.Writer
+	json bool
+	// errors is where errors are also written when the logs go to a -log-file, so whoever
+	// ran the command still sees why it failed
+	errors io.Writer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	now := time.Now()
+	msg := redactSecrets(strings.TrimSuffix(string(p), "\n"))
+	level, text := "error", msg
+	for _, l := range []string{"debug", "warning"} {
+		if rest, ok := strings.CutPrefix(msg, l+": "); ok {
+			level, text = l, rest
+			break
+		}
+	}
+
+	// The same format the log package writes by default
+	plain := fmt.Sprintf("%s %s\n", now.Format("2006/01/02 15:04:05"), msg)
+	line := []byte(plain)
+	if w.json {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		err := enc.Encode(logEntry{
+			Time:    now.UTC().Format(time.RFC3339Nano),
+			Level:   level,
+			Msg:     text,
+			Profile: profileOrDefault(),
+		})
+		if err != nil {
+			return 0, err
+		}
+		line = buf.Bytes()
+	}
+
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	if w.errors != nil && level == "error" {
+		w.errors.Write([]byte(plain))
+	}
+	return len(p), nil
+}
+
+// setupLogging sends the log package's output through a logWriter, in the -log-format
+// and to the -log-file. Anything logged before then, like flag errors, is written as is
+func setupLogging() error {
+	if loggingConfigured {
+		return nil
+	}
+	if logFormat != logFormatText && logFormat != logFormatJSON {
+		return fmt.Errorf("invalid -log-format %q, expected %s or %s", logFormat, logFormatText, logFormatJSON)
+	}
+
+	w := &logWriter{out: os.Stderr, json: logFormat == logFormatJSON}
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open log file, %w", err)
+		}
+		w.out, w.errors = f, os.Stderr
+	}
+	log.SetFlags(0)
+	log.SetOutput(w)
+	loggingConfigured = true
+	return nil
+}
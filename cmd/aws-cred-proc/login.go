@@ -0,0 +1,52 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "login",
+		usage: "mint a new session for the profile now, prompting for MFA if needed, and cache it so later non-interactive invocations (editors, cron, etc) find valid credentials without prompting",
+		run:   runLogin,
+	})
+}
+
+func runLogin(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageIfNeeded = "keep the cached session if it remains valid for -min-validity, instead of always minting a new one"
+	)
+	var ifNeeded bool
+
+	addCredentialFlags(fs)
+	fs.BoolVar(&ifNeeded, "if-needed", false, usageIfNeeded)
+	fs.Parse(args)
+
+	if noCache {
+		return fmt.Errorf("login caches the session, and can't be used with -no-cache")
+	}
+	// A new session lasts the full -duration, which is the point of logging in ahead of time
+	forceRefresh = !ifNeeded
+
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+	creds, err := src.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	verb := "Logged in"
+	if src.stats.cache == "hit" {
+		verb = "Already logged in"
+	}
+	fmt.Fprintf(os.Stderr, "%s to %q until %s\n", verb, profileOrDefault(), creds.Expires.Local().Format(time.RFC1123))
+	return nil
+}
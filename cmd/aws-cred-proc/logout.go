@@ -0,0 +1,62 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "logout",
+		usage: "drop the session state for the profile (or every profile with -all): cached credentials, and with -all the Bitwarden session key kept in the OS keyring. Optionally signs out of the AWS console too",
+		run:   runLogout,
+	})
+}
+
+func runLogout(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageAll     = "log out of every profile, and forget the Bitwarden session key kept in the OS keyring"
+		usageShred   = "overwrite the cache files with random data before removing them"
+		usageConsole = "also open the AWS console sign-out page in the default browser"
+	)
+	var all, shred, console bool
+
+	addCredentialFlags(fs)
+	fs.BoolVar(&all, "all", false, usageAll)
+	fs.BoolVar(&shred, "shred", false, usageShred)
+	fs.BoolVar(&console, "console", false, usageConsole)
+	fs.Parse(args)
+
+	if err := clearCacheEntries(ctx, all, shred); err != nil {
+		return err
+	}
+
+	// The Bitwarden session unlocks the vault for every profile, so it is only dropped with -all
+	if all {
+		err := keyringDelete(bitwardenSessionAccount)
+		switch {
+		case err == nil:
+			fmt.Fprintln(os.Stderr, "Removed the Bitwarden session key from the OS keyring")
+		case !errors.Is(err, errKeyringNotFound):
+			// Not fatal, the keyring may not be available at all, e.g. on a headless host
+			log.Printf("warning: failed to remove the Bitwarden session key, %v", err)
+		}
+	}
+
+	if console {
+		region, _ := resolveRegion(ctx)
+		signinHost, _ := consoleEndpoints(region)
+		signOutURL := fmt.Sprintf("https://%s/oauth?Action=logout", signinHost)
+		if err := openBrowser(signOutURL); err != nil {
+			return fmt.Errorf("failed to open the browser, %w", err)
+		}
+		fmt.Fprintln(os.Stderr, "Opened the console sign-out page")
+	}
+	return nil
+}
@@ -0,0 +1,1017 @@
+/*
+Proof-of-concept utility for use as an aws CLI credential_process
+that performes aws CLI compatible caching/refreshing of credentials
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mattn/go-tty"
+	"github.com/ryandeivert/aws-cred-proc/pkg/cache"
+	"github.com/ryandeivert/aws-cred-proc/pkg/output"
+)
+
+// Which credentials to resolve, and how long they last
+var (
+	profile             string        // -profile, empty for AWS_PROFILE or the picker
+	duration            time.Duration // -duration, 0 for the profile's or role's default
+	sessionNameTemplate string        // -role-session-name, a template, see roleSessionName
+	sessionPolicyFile   string        // -session-policy
+	lookupAccountID     bool          // -account-id
+	wrapCommand         string        // -wrap, another credential_process to cache
+)
+
+// The cache, see CLICache
+var (
+	noCache      bool // -no-cache
+	forceRefresh bool // -force-refresh
+	cacheOnly    bool // -cache-only
+	maxRefreshes int  // -max-refreshes
+	dpapiCache   bool // -dpapi (Windows only)
+	windowsHello bool // -windows-hello (Windows only)
+	protectMem   bool // -protect-memory, keeps the credentials out of core dumps
+)
+
+// The MFA token providers, see tokenProvider
+var (
+	mfaYK           bool   // -mfa-yk
+	ykSerial        string // -yk-serial
+	ykTouchRetries  int    // -yk-touch-retries
+	noNotify        bool   // -no-notify
+	mfaTOTP         bool   // -mfa-totp
+	mfaOPItem       string // -mfa-op
+	mfaBWItem       string // -mfa-bw
+	mfaPassEntry    string // -mfa-pass
+	mfaPassCommand  string // -mfa-pass-cmd
+	mfaProcess      string // -mfa-process
+	mfaPinentry     bool   // -mfa-pinentry
+	pinentryProgram string // -pinentry-program
+	askPassword     bool   // -ask-password
+)
+
+// Other sources of credentials
+var (
+	cognitoPool    string            // -cognito-pool
+	cognitoRoleArn string            // -cognito-role-arn
+	cognitoLogin   = cognitoLogins{} // -cognito-login, repeated
+	systemdCreds   bool              // -systemd-creds
+	noIMDS         bool              // -no-imds
+)
+
+// Device attestation of AssumeRole calls, see attestation.go
+var (
+	attestationCmd    string // -attestation-cmd
+	attestationAs     string // -attestation-as
+	attestationTagKey string // -attestation-tag-key
+)
+
+// Where -attestation-as puts the attestation token
+const (
+	attestAsTag            = "tag"
+	attestAsSourceIdentity = "source-identity"
+)
+
+// How STS is called
+var (
+	awsRegion            string        // -region
+	stsEndpoint          string        // -sts-endpoint
+	stsGlobalEndpoint    bool          // -sts-global-endpoint
+	stsFailoverRegions   string        // -sts-failover-regions
+	useFIPSEndpoint      bool          // -fips-endpoint
+	useDualStackEndpoint bool          // -dualstack-endpoint
+	caBundle             string        // -ca-bundle
+	retryMaxAttempts     int           // -retry-max-attempts
+	retryMaxBackoff      time.Duration // -retry-max-backoff
+)
+
+// The output of the default invocation
+var (
+	outputName          string // -output
+	outputQuery         string // -query
+	outFile             string // -out
+	encryptTo           string // -encrypt-to
+	systemdCredOut      string // -systemd-credential-out
+	systemdCredEncrypt  bool   // -systemd-credential-encrypt
+	watchMode           bool   // -watch
+	resolveStatsTrailer bool   // -resolve-stats
+)
+
+const shorthandPrefix = "shorthand for "
+
+// deprecatedPrefix marks flags that still work, but are left out of the usage
+const deprecatedPrefix = "deprecated, "
+
+func init() {
+	const (
+		usageOutput             = "the output `format`: json (for credential_process), env (shell exports), env-unset (unset the env variables), fish (set -gx statements), powershell ($env: assignments for Invoke-Expression), cmd (SET commands), dotenv (KEY=value lines for .env files), ini (a shared credentials file section), template (see -template) or k8s-exec (an ExecCredential for kubectl, see -k8s-cluster)"
+		usageEncryptTo          = "encrypt the output for this `scheme:recipient` so it can be passed through logs, queues, etc to a consumer holding the key. Supported schemes: age (with the age CLI, e.g. age:age1...)"
+		usageTemplate           = "the Go `template` for -output template, e.g. '{{.AccessKeyID}}:{{.Expires}}'. The fields of aws.Credentials are available, along with .Region and .Profile"
+		usageQuery              = "print only this part of the JSON output, selected with a subset of JMESPath (dotted field names and [n] indexes), e.g. -query Expiration. Strings are printed without quotes"
+		usageK8sCluster         = "the EKS cluster name the -output k8s-exec token is for"
+		usageResolveStats       = "print AWS_CRED_PROC_CACHE (hit, miss, stale or disabled) and AWS_CRED_PROC_RESOLVE_MS to stderr after the credentials are resolved, so wrapper scripts can log the overhead of authenticating"
+		usageOut                = "write the output to this `file`, atomically, instead of stdout. e.g. -output dotenv -out .env.aws"
+		usageSystemdCredOut     = "also write the credentials to /run/credstore/<name> so dependent systemd units can read them with LoadCredential=<name>"
+		usageWatch              = "keep running, refreshing the credentials -expiry-window before they expire and rewriting -out or -systemd-credential-out each time. MFA prompts come with a desktop notification"
+		usageSystemdCredEncrypt = "encrypt the -systemd-credential-out credential with systemd-creds, writing it to /run/credstore.encrypted/<name> for LoadCredentialEncrypted=<name>"
+	)
+	addCredentialFlags(flag.CommandLine)
+	flag.StringVar(&outputName, "output", "json", usageOutput)
+	flag.StringVar(&outputName, "o", "json", shorthandPrefix+"-output")
+	flag.BoolFunc("variables", deprecatedPrefix+"use -output env", deprecatedVariables)
+	flag.BoolFunc("v", deprecatedPrefix+"use -output env", deprecatedVariables)
+	flag.StringVar(&outFile, "out", "", usageOut)
+	flag.StringVar(&outputTemplate, "template", "", usageTemplate)
+	flag.StringVar(&outputQuery, "query", "", usageQuery)
+	flag.StringVar(&k8sCluster, "k8s-cluster", "", usageK8sCluster)
+	flag.StringVar(&encryptTo, "encrypt-to", "", usageEncryptTo)
+	flag.BoolVar(&resolveStatsTrailer, "resolve-stats", false, usageResolveStats)
+	flag.StringVar(&systemdCredOut, "systemd-credential-out", "", usageSystemdCredOut)
+	flag.BoolVar(&systemdCredEncrypt, "systemd-credential-encrypt", false, usageSystemdCredEncrypt)
+	flag.BoolVar(&watchMode, "watch", false, usageWatch)
+	flag.Usage = usage
+}
+
+// deprecatedVariables keeps -variables and -v working as -output env, which replaced them
+func deprecatedVariables(value string) error {
+	set, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	log.Print("warning: -variables is deprecated, use -output env")
+	if set {
+		outputName = "env"
+	}
+	return nil
+}
+
+// cognitoLogins collects repeated -cognito-login provider=token flags
+type cognitoLogins map[string]string
+
+func (l cognitoLogins) String() string {
+	providers := make([]string, 0, len(l))
+	for p := range l {
+		providers = append(providers, p)
+	}
+	sort.Strings(providers)
+	return strings.Join(providers, ",")
+}
+
+func (l cognitoLogins) Set(value string) error {
+	provider, token, ok := strings.Cut(value, "=")
+	if !ok || provider == "" || token == "" {
+		return fmt.Errorf("expected provider=token, got %q", value)
+	}
+	l[provider] = token
+	return nil
+}
+
+// addCredentialFlags registers the flags that control how credentials are resolved
+// so subcommands can share them with the default credential_process invocation
+func addCredentialFlags(fs *flag.FlagSet) {
+	const (
+		usageProfile      = "the optional aws config profile to use for credentials. If left empty, either the current env will dictate the profile or you are asked to choose one when on a terminal, or \"default\" will be used"
+		usageNoCache      = "disable caching credentials in the ~/.aws/cli/cache directory"
+		usageDPAPI        = "encrypt the cached credentials with DPAPI so only the current Windows user can read them. Encrypted entries are kept apart from the plaintext ones the aws CLI uses (Windows only)"
+		usageHello        = "require Windows Hello verification (face, fingerprint or PIN) before any credentials are returned (Windows only)"
+		usageDuration     = "duration for which these credentials will remain valid. 0 sends no duration, so the profile's duration_seconds or the STS default (1 hour) applies"
+		usageYK           = "read MFA token from YubiKey versus prompting via stdin. Requires setting mfa_serial in the profile config, or the AWS_MFA_SERIAL env var"
+		usageYKSerial     = "serial number of the YubiKey to read the MFA token from when more than one is attached. Can also be set with yubikey_serial in the profile config"
+		usageYKRetries    = "number of times to prompt again when the YubiKey is not touched in time"
+		usageNoNotify     = "do not show a desktop notification when the YubiKey needs to be touched"
+		usageTOTP         = "compute the MFA token from a TOTP seed stored in the OS keyring (see the totp command). Requires setting mfa_serial in the profile config, or the AWS_MFA_SERIAL env var"
+		usageOP           = "read the MFA token from this 1Password item's one-time password using the op CLI"
+		usageBW           = "read the MFA token from this Bitwarden item's TOTP using the bw CLI. Uses BW_SESSION if set, otherwise prompts to unlock the vault and keeps the session key in the OS keyring"
+		usagePass         = "read the MFA token from this password store entry using the pass-otp extension (or gopass, see -mfa-pass-cmd)"
+		usagePassCmd      = "the password store command used by -mfa-pass and the pass_credentials and pass_totp_seed profile settings: pass or gopass"
+		usageMFAProcess   = "run this `command` for the MFA token, which it prints to stdout, to read it from a password manager or HSM without built in support. Can also be set with mfa_process in the profile config"
+		usagePinentry     = "prompt for the MFA token with a GnuPG pinentry program, which also works without a TTY when a graphical pinentry is installed"
+		usagePinentryProg = "the pinentry program used by -mfa-pinentry"
+		usageAskPassword  = "prompt for the MFA token, and passphrases like the Bitwarden master password, with systemd-ask-password so headless sessions and services can answer through the system password agent"
+		usageForceRefresh = "ignore any cached items and force a refresh of the credentials. The newly generated credentials will be cached for future use. To disable caching entirely, use the -no-cache flag"
+		usageNoIMDS       = "never fall back on EC2 instance metadata (IMDS) or ECS container credentials. Also implied for IMDS by AWS_EC2_METADATA_DISABLED=true"
+		usageProtectMem   = "disable core dumps and, on Linux, mark the process non-dumpable so credentials in memory can't be captured by crash dumps or other processes"
+		usageFileMode     = "permission `mode`, in octal, of every file written (caches, generated configs, etc). Directories that are created get the same mode plus search permission. The mode is verified after each write"
+		usageMaxRefreshes = "limit how many processes may refresh the same credentials at once. Others wait, then use the refreshed credentials from the cache, so a build that starts many tools at once respects STS quotas and prompts for MFA once. The default of 1 has exactly one refresh, and 0 is unlimited"
+		usageAccountID    = "look up the account ID with sts:GetCallerIdentity, when no role is assumed, so it can be included in the output. The account of an assumed role is always included"
+		usageSystemdCreds = "read the source credentials from the aws_access_key_id, aws_secret_access_key and optional aws_session_token systemd credentials in $CREDENTIALS_DIRECTORY, in place of the profile's source_profile"
+		usagePolicy       = "`file` containing a JSON IAM policy document to pass as the session policy of the AssumeRole call, further restricting the role's permissions. Credentials are cached separately for each policy"
+		usageUsageStats   = "record when each session is minted and read from the cache, for the stats command"
+		usageMinValidity  = "how long credentials must remain valid for. Cached credentials expiring sooner are refreshed, and if the refreshed ones still do, the command fails with exit status 3 rather than output them"
+		usageMFASession   = "get an MFA session for the IAM user with GetSessionToken that lasts this `duration` (15m to 36h), cache it, and assume roles with it rather than passing the MFA to each AssumeRole call, so switching between roles needs one MFA prompt. 0 disables it"
+		usageNotifyBefore = "with -watch and sudo, show a desktop notification this long before the credentials expire, unless they have been refreshed by then. 0 disables it"
+		usageCacheOnly    = "only use cached credentials, failing at once if there are none valid for -min-validity rather than calling STS, e.g. on a plane or in a sandbox without network access. Implies -no-imds"
+		usageMaxStale     = "when cached credentials are due for a refresh but STS can't be reached or is throttling, output them anyway, with a warning, if they expired no longer than this ago. 0 fails instead"
+		usageExpiryWindow = "refresh cached credentials this long before they expire, so long-running tools aren't handed credentials that expire moments later. Unlike -min-validity, credentials that are refreshed and still expire within it are output"
+		usageRegion       = "the region to resolve credentials for and call STS in, taking precedence over the environment and the profile (see Region Resolution in the README)"
+		usageRegionIMDS   = "when nothing else sets the region, use the placement of the EC2 instance from instance metadata, rather than us-east-1. Off EC2 this waits up to a second for IMDS each time"
+		usageSTSGlobal    = "call the global STS endpoint (sts.amazonaws.com) for AssumeRole instead of the endpoint of the region, for roles whose trust or SCPs expect it. Only in the aws partition"
+		usageSTSEndpoint  = "the `url` of the STS endpoint to call instead of the public one, e.g. a VPC endpoint, or localstack or moto for testing"
+		usageCABundle     = "PEM `file` of extra certificate authorities to trust, e.g. those of a TLS-intercepting corporate proxy. Defaults to AWS_CA_BUNDLE or the profile's ca_bundle"
+		usageFIPS         = "use the FIPS endpoints of STS (and Cognito), e.g. for FedRAMP. Also enabled by use_fips_endpoint in the profile or AWS_USE_FIPS_ENDPOINT"
+		usageDualStack    = "use the dual-stack (IPv4 and IPv6) endpoints of STS. Also enabled by use_dualstack_endpoint in the profile or AWS_USE_DUALSTACK_ENDPOINT"
+		usageRetries      = "how many times STS calls are attempted, retrying throttling and transient errors with exponential backoff and jitter. 0 leaves it to the profile's max_attempts, or the SDK default of 3"
+		usageRetryBackoff = "the longest to back off between STS attempts. 0 is the SDK default of 20s"
+		usageTimeout      = "give up resolving credentials after this long, including any prompts, and exit with status 124. 0 waits indefinitely"
+		usageSTSFailover  = "comma separated `regions` whose STS endpoints AssumeRole fails over to, in order, when the endpoint of the resolved region can't be reached or returns server errors. Can also be set with sts_failover_regions in the profile config"
+		usageSessionName  = "role session name to use, overriding role_session_name in the profile. Supports the {username}, {hostname}, {tool} and {profile} placeholders, and is sanitized to the characters STS allows"
+		usageAttestCmd    = "command that prints a device attestation token (e.g. from a TPM quote or Secure Enclave assertion helper) to attach to each AssumeRole call, so IAM policies can require attested devices"
+		usageAttestAs     = "how to attach the -attestation-cmd token: tag (a session tag) or source-identity (a suffix of the SourceIdentity)"
+		usageAttestTagKey = "the session tag key used for the -attestation-cmd token"
+		usageCognitoPool  = "exchange a Cognito identity from this identity pool (<region>:<uuid>) for credentials instead of using the profile"
+		usageCognitoLogin = "provider=token login to use for an authenticated Cognito identity. May be repeated. If omitted, an unauthenticated identity is used"
+		usageCognitoRole  = "optional role ARN to request when the identity pool allows role selection"
+		usageWrap         = "run this credential_process `command` for the credentials instead of using the profile, adding caching, -min-validity refresh and the output formats to helpers that have none"
+		usageDebug        = "log how the credentials are resolved to stderr: the profile chain, cache key, cache hit or miss, STS call timings and MFA provider. Secrets are never logged"
+		usageLogFormat    = "the `format` of the messages written to stderr or -log-file: text, or json for one object per line with time, level, msg and profile fields. Secrets are redacted either way"
+		usageCacheKeyHash = "the `hash` cache file names are computed with: sha1, as the aws CLI does, or sha256 to interoperate with a botocore that hashes its cache keys with it. Entries named with the other hash are still read, so switching doesn't start a new session"
+		usageCacheBackend = "where cache entries are kept: file (the aws CLI's cache directory, shared with it), keyring (the OS keyring, keeping credentials off disk) or memory (only for the life of the process, e.g. with -watch)"
+		usageLogFile      = "append the messages to this `file` instead of stderr. Errors are still written to stderr as well"
+	)
+	credentialFlags = fs
+	fs.StringVar(&profile, "profile", "", usageProfile)
+	fs.StringVar(&profile, "p", "", shorthandPrefix+"-profile")
+	fs.BoolVar(&noCache, "no-cache", false, usageNoCache)
+	fs.BoolVar(&noCache, "n", false, shorthandPrefix+"-no-cache")
+	fs.BoolVar(&dpapiCache, "dpapi", false, usageDPAPI)
+	fs.BoolVar(&windowsHello, "windows-hello", false, usageHello)
+	fs.DurationVar(&duration, "duration", time.Minute*60, usageDuration)
+	fs.DurationVar(&duration, "d", time.Minute*60, shorthandPrefix+"-duration")
+	fs.BoolVar(&mfaYK, "mfa-yk", false, usageYK)
+	fs.BoolVar(&mfaYK, "m", false, shorthandPrefix+"-mfa-yk")
+	fs.StringVar(&ykSerial, "yk-serial", "", usageYKSerial)
+	fs.IntVar(&ykTouchRetries, "yk-touch-retries", 2, usageYKRetries)
+	fs.BoolVar(&noNotify, "no-notify", false, usageNoNotify)
+	fs.BoolVar(&mfaTOTP, "mfa-totp", false, usageTOTP)
+	fs.StringVar(&mfaOPItem, "mfa-op", "", usageOP)
+	fs.StringVar(&mfaBWItem, "mfa-bw", "", usageBW)
+	fs.StringVar(&mfaPassEntry, "mfa-pass", "", usagePass)
+	fs.StringVar(&mfaPassCommand, "mfa-pass-cmd", "pass", usagePassCmd)
+	fs.StringVar(&mfaProcess, "mfa-process", "", usageMFAProcess)
+	fs.Var(mfaSessionFlag{&mfaSessionDuration}, "mfa-session", usageMFASession)
+	fs.BoolVar(&mfaPinentry, "mfa-pinentry", false, usagePinentry)
+	fs.StringVar(&pinentryProgram, "pinentry-program", "pinentry", usagePinentryProg)
+	fs.BoolVar(&askPassword, "ask-password", false, usageAskPassword)
+	fs.BoolVar(&forceRefresh, "force-refresh", false, usageForceRefresh)
+	fs.BoolVar(&forceRefresh, "f", false, shorthandPrefix+"-force-refresh")
+	fs.BoolVar(&noIMDS, "no-imds", false, usageNoIMDS)
+	fs.BoolVar(&protectMem, "protect-memory", false, usageProtectMem)
+	fs.Var(fileModeFlag{&fileMode}, "file-mode", usageFileMode)
+	fs.BoolVar(&systemdCreds, "systemd-creds", false, usageSystemdCreds)
+	fs.IntVar(&maxRefreshes, "max-refreshes", 1, usageMaxRefreshes)
+	fs.StringVar(&cacheKeyHash, "cache-key-hash", cacheKeyHashSHA1, usageCacheKeyHash)
+	fs.StringVar(&cacheBackendName, "cache-backend", cacheBackendFile, usageCacheBackend)
+	fs.BoolVar(&lookupAccountID, "account-id", false, usageAccountID)
+	fs.BoolVar(&recordUsageStats, "usage-stats", false, usageUsageStats)
+	fs.DurationVar(&minValidity, "min-validity", time.Minute, usageMinValidity)
+	fs.DurationVar(&expiryWindow, "expiry-window", 5*time.Minute, usageExpiryWindow)
+	fs.DurationVar(&maxStale, "max-stale", 0, usageMaxStale)
+	fs.BoolVar(&cacheOnly, "cache-only", false, usageCacheOnly)
+	fs.DurationVar(&notifyBefore, "notify-before", 10*time.Minute, usageNotifyBefore)
+	fs.StringVar(&awsRegion, "region", "", usageRegion)
+	fs.BoolVar(&regionFromIMDS, "region-from-imds", false, usageRegionIMDS)
+	fs.BoolVar(&stsGlobalEndpoint, "sts-global-endpoint", false, usageSTSGlobal)
+	fs.StringVar(&stsEndpoint, "sts-endpoint", "", usageSTSEndpoint)
+	fs.StringVar(&caBundle, "ca-bundle", "", usageCABundle)
+	fs.BoolVar(&useFIPSEndpoint, "fips-endpoint", false, usageFIPS)
+	fs.BoolVar(&useDualStackEndpoint, "dualstack-endpoint", false, usageDualStack)
+	fs.StringVar(&stsFailoverRegions, "sts-failover-regions", "", usageSTSFailover)
+	fs.IntVar(&retryMaxAttempts, "retry-max-attempts", 0, usageRetries)
+	fs.DurationVar(&retryMaxBackoff, "retry-max-backoff", 0, usageRetryBackoff)
+	fs.DurationVar(&resolveTimeout, "timeout", 0, usageTimeout)
+	fs.StringVar(&sessionNameTemplate, "role-session-name", "", usageSessionName)
+	fs.StringVar(&sessionPolicyFile, "session-policy", "", usagePolicy)
+	fs.StringVar(&attestationCmd, "attestation-cmd", "", usageAttestCmd)
+	fs.StringVar(&attestationAs, "attestation-as", attestAsTag, usageAttestAs)
+	fs.StringVar(&attestationTagKey, "attestation-tag-key", "Attestation", usageAttestTagKey)
+	fs.StringVar(&cognitoPool, "cognito-pool", "", usageCognitoPool)
+	fs.Var(cognitoLogin, "cognito-login", usageCognitoLogin)
+	fs.StringVar(&cognitoRoleArn, "cognito-role-arn", "", usageCognitoRole)
+	fs.StringVar(&wrapCommand, "wrap", "", usageWrap)
+	fs.BoolVar(&debugLog, "debug", false, usageDebug)
+	fs.StringVar(&logFormat, "log-format", logFormatText, usageLogFormat)
+	fs.StringVar(&logFile, "log-file", "", usageLogFile)
+}
+
+// CLICache loads credentials through a cache.Provider configured by the flags, tracking
+// how they were loaded for -resolve-stats and the usage stats
+type CLICache struct {
+	entry        *cache.Provider
+	cacheKey     computableCacheKey
+	forceRefresh bool
+	hit          bool
+	stale        bool
+}
+
+func NewCache(provider aws.CredentialsProvider, forceRefresh, encrypt bool, cacheKey computableCacheKey) *CLICache {
+	entry := cache.New(provider, cache.Key(cacheKey), func(o *cache.Options) {
+		o.Backend = cacheBackend
+		o.KeyHash = cacheKeyHash
+		// Credentials are also refreshed when they would be too close to expiring to output
+		o.ExpiryWindow = max(expiryWindow, minValidity)
+		o.ForceRefresh = forceRefresh
+		o.MaxRefreshes = maxRefreshes
+		o.AcquireSlot = acquireSlot
+		o.Logf = log.Printf
+		if encrypt {
+			o.Encryption = dpapiEncryption
+		}
+	})
+	return &CLICache{entry: entry, cacheKey: cacheKey, forceRefresh: forceRefresh}
+}
+
+// dpapiEncryption encrypts -dpapi entries
+var dpapiEncryption = &cache.Encryption{
+	Extension: ".dpapi",
+	Seal:      dpapiProtect,
+	Open:      dpapiUnprotect,
+}
+
+func assumeRoleCacheKey(opts stscreds.AssumeRoleOptions) computableCacheKey {
+	return computableCacheKey(cache.AssumeRoleKey(opts))
+}
+
+// cliCacheDir is the directory the aws CLI caches assumed role credentials in
+func cliCacheDir() string {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return dir
+}
+
+func (c *CLICache) name() string {
+	return c.entry.Name()
+}
+
+// location describes where the entry is kept, e.g. the path of its file
+func (c *CLICache) location() string {
+	return c.entry.Location()
+}
+
+// legacyNames returns the names the entry may have been written under before, see
+// cache.Provider.LegacyNames
+func (c *CLICache) legacyNames() []string {
+	return c.entry.LegacyNames()
+}
+
+// remove deletes the entry, returning an error wrapping os.ErrNotExist if there is none
+func (c *CLICache) remove() error {
+	return c.entry.Delete()
+}
+
+func (c *CLICache) Load(ctx context.Context) (aws.Credentials, error) {
+	if cacheOnly {
+		creds, err := c.get()
+		if errors.Is(err, os.ErrNotExist) || (err == nil && expiresSoon(creds)) {
+			return aws.Credentials{}, fmt.Errorf("no valid cached credentials for profile %q, and -cache-only never calls STS", profileOrDefault())
+		}
+		if err != nil {
+			return creds, err
+		}
+		recordUsage(c.cacheKey.String(), creds, false)
+		c.hit = true
+		return creds, nil
+	}
+
+	// Do not bother to check the cache if we're forcing a refresh
+	if !c.forceRefresh {
+		creds, err := c.get()
+		if err == nil && !refreshDue(creds) {
+			recordUsage(c.cacheKey.String(), creds, false)
+			c.hit = true
+			return creds, err // credentials are still valid
+		}
+	}
+
+	// Fall back on the credential provider to get creds, unless another process refreshed
+	// them while this one waited for a -max-refreshes slot
+	waitStart := time.Now()
+	creds, cached, err := c.entry.Refresh(ctx)
+	if err != nil {
+		if stale, ok := c.staleFallback(err); ok {
+			return stale, nil
+		}
+		return creds, err
+	}
+	if cached {
+		debugf("using the credentials another process refreshed while this one waited %s", time.Since(waitStart).Round(time.Millisecond))
+		c.hit = true
+	}
+	recordUsage(c.cacheKey.String(), creds, !cached)
+
+	return creds, nil
+}
+
+// staleFallback returns the cached credentials in place of a refresh that failed because
+// STS couldn't be reached or was throttling, if they expired no longer than -max-stale ago
+func (c *CLICache) staleFallback(err error) (aws.Credentials, bool) {
+	if maxStale <= 0 || !stsUnreachable(err) {
+		return aws.Credentials{}, false
+	}
+	creds, cacheErr := c.get()
+	if cacheErr != nil || time.Since(creds.Expires) > maxStale {
+		return aws.Credentials{}, false
+	}
+	log.Printf("warning: using the cached credentials valid until %s, since they could not be refreshed, %v", creds.Expires.Local().Format(time.RFC1123), err)
+	recordUsage(c.cacheKey.String(), creds, false)
+	c.stale = true
+	return creds, true
+}
+
+// get returns the cached credentials, see cache.Provider.Get
+func (c *CLICache) get() (aws.Credentials, error) {
+	return c.entry.Get()
+}
+
+// readCacheItem decodes the cache file at path, decrypting it if it is encrypted
+func readCacheItem(path string, encrypted bool) (*cache.Item, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache file, %w", err)
+	}
+	return decodeCacheItem(data, encrypted)
+}
+
+// decodeCacheItem decodes a cache entry, decrypting it if it is encrypted
+func decodeCacheItem(data []byte, encrypted bool) (*cache.Item, error) {
+	var err error
+	if encrypted {
+		if data, err = dpapiUnprotect(data); err != nil {
+			return nil, err
+		}
+	}
+	return cache.Decode(data)
+}
+
+// save caches creds, see cache.Provider.Put
+func (c *CLICache) save(creds aws.Credentials) error {
+	return c.entry.Put(creds)
+}
+
+// computableCacheKey is the inputs a cache entry's name is computed from, hashed with
+// the -cache-key-hash algorithm
+type computableCacheKey cache.Key
+
+func (v computableCacheKey) String() string {
+	return v.hashed(cacheKeyHash)
+}
+
+// hashed returns the key hashed with the given -cache-key-hash algorithm
+func (v computableCacheKey) hashed(algorithm string) string {
+	return cache.Key(v).Hash(algorithm)
+}
+
+// Algorithms of -cache-key-hash
+const (
+	cacheKeyHashSHA1   = cache.HashSHA1
+	cacheKeyHashSHA256 = cache.HashSHA256
+)
+
+// cacheKeyHash is the algorithm cache keys are hashed with, set with -cache-key-hash
+var cacheKeyHash = cacheKeyHashSHA1
+
+// otherCacheKeyHash returns the -cache-key-hash algorithm that isn't in use
+func otherCacheKeyHash() string {
+	if cacheKeyHash == cacheKeyHashSHA256 {
+		return cacheKeyHashSHA1
+	}
+	return cacheKeyHashSHA256
+}
+
+func TTYPrompt() (string, error) {
+	tty, err := tty.Open()
+	if err != nil {
+		// There is no controlling terminal when invoked from GUI apps (IDEs, etc),
+		// so fall back on a graphical dialog
+		code, dialogErr := dialogPrompt()
+		if dialogErr != nil {
+			return "", fmt.Errorf("failed to open tty (%v) and dialog prompt failed, %w", err, dialogErr)
+		}
+		return code, nil
+	}
+	defer tty.Close()
+	defer onAbort(func() { tty.Close() })()
+
+	fmt.Fprint(tty.Output(), "MFA Code: ")
+
+	text, err := tty.ReadString()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(text), nil
+}
+
+// stateDir is where files belonging to this tool, rather than the aws CLI, are kept
+func stateDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return filepath.Join(home, ".aws", "cred-proc")
+}
+
+func writeToStdOut(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// credentialSource is the uncached credentials provider selected by the credential
+// flags, along with the key its credentials are cached under and the region they are for
+type credentialSource struct {
+	provider     aws.CredentialsProvider
+	cacheKey     computableCacheKey
+	region       string
+	regionSource string
+	stats        resolveStats
+
+	// sourceCredentials are those the role is assumed with, and progress the pipeline's
+	// commands between the source, mfa and assume stages, see finishStage
+	sourceCredentials aws.CredentialsProvider
+	progress          *retrieveProgress
+}
+
+// resolveStats describes how the credentials were last loaded, for wrapper scripts
+// that log the overhead of authenticating
+type resolveStats struct {
+	cache   string // hit, miss, stale or disabled
+	elapsed time.Duration
+}
+
+// env returns the stats as AWS_CRED_PROC_* variables, in the os.Environ format
+func (s resolveStats) env() []string {
+	return []string{
+		"AWS_CRED_PROC_CACHE=" + s.cache,
+		fmt.Sprintf("AWS_CRED_PROC_RESOLVE_MS=%d", s.elapsed.Milliseconds()),
+	}
+}
+
+// newCredentialSource sets up the credentials provider without retrieving anything,
+// so the cache key for the flags and profile can be computed without any MFA prompts
+func newCredentialSource(ctx context.Context) (*credentialSource, error) {
+	if err := selectProfile(); err != nil {
+		return nil, err
+	}
+	if err := applyFlagDefaults(credentialFlags); err != nil {
+		return nil, err
+	}
+	if err := setupLogging(); err != nil {
+		return nil, err
+	}
+
+	// The max session duration is 12 hours, so use that as the upper bound
+	// IAM Roles can set their own max duration, but this is a sane default
+	// and the assume role call will fail if a duration is set above the max
+	if duration != 0 && !(time.Minute*15 <= duration && duration <= time.Hour*12) {
+		return nil, fmt.Errorf("duration must be 0 (the role's default) or between 15 minutes and 12 hours")
+	}
+	if duration != 0 && minValidity >= duration {
+		return nil, fmt.Errorf("-min-validity must be less than -duration")
+	}
+	if duration != 0 && expiryWindow >= duration {
+		return nil, fmt.Errorf("-expiry-window must be less than -duration")
+	}
+
+	if attestationAs != attestAsTag && attestationAs != attestAsSourceIdentity {
+		return nil, fmt.Errorf("invalid -attestation-as value %q, expected %s or %s", attestationAs, attestAsTag, attestAsSourceIdentity)
+	}
+
+	if stsEndpoint != "" {
+		if err := validateSTSEndpoint(stsEndpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	if cacheKeyHash != cacheKeyHashSHA1 && cacheKeyHash != cacheKeyHashSHA256 {
+		return nil, fmt.Errorf("invalid -cache-key-hash %q, expected %s or %s", cacheKeyHash, cacheKeyHashSHA1, cacheKeyHashSHA256)
+	}
+	backend, err := lookupCacheBackend(cacheBackendName)
+	if err != nil {
+		return nil, err
+	}
+	cacheBackend = backend
+
+	if cacheOnly && (noCache || forceRefresh) {
+		return nil, fmt.Errorf("-cache-only can't be used with -no-cache or -force-refresh")
+	}
+	// The session is only shared between roles and runs through the cache
+	if mfaSessionDuration > 0 && noCache {
+		return nil, fmt.Errorf("-mfa-session can't be used with -no-cache")
+	}
+
+	if dpapiCache && !dpapiSupported {
+		return nil, fmt.Errorf("-dpapi is only available on Windows, and not in the minimal build")
+	}
+
+	if protectMem {
+		if err := protectMemory(); err != nil {
+			return nil, err
+		}
+	}
+
+	var sessionPolicy string
+	if sessionPolicyFile != "" {
+		var err error
+		if sessionPolicy, err = readSessionPolicy(sessionPolicyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if cognitoPool != "" && wrapCommand != "" {
+		return nil, fmt.Errorf("-cognito-pool and -wrap can't be used together")
+	}
+
+	if err := loadCABundle(ctx); err != nil {
+		return nil, err
+	}
+
+	src := &credentialSource{}
+
+	if cognitoPool != "" {
+		var err error
+		if src, err = newCognitoSource(); err != nil {
+			return nil, err
+		}
+	} else if wrapCommand != "" {
+		var err error
+		if src, err = newWrapSource(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		var opts stscreds.AssumeRoleOptions
+		var hops *hopCacher
+		if !noCache {
+			hops = newHopCacher(ctx)
+		}
+
+		configureAssumeRole := func(o *stscreds.AssumeRoleOptions) {
+			// The default TTYPrompt allows you to enter the MFA token without the input
+			// being captured by awscli (which captures stdin/stdout). Flags select other
+			// token providers, like yubikey, a stored TOTP seed, etc
+			// Note: a TokenProvider is required if mfa_serial is set (shared config, env, etc)
+			tokens := tokenProvider(o.SerialNumber)
+			o.TokenProvider = func() (string, error) {
+				if err := src.finishStage(sourceStageName); err != nil {
+					return "", err
+				}
+				code, err := tokens()
+				if err != nil {
+					return "", err
+				}
+				return code, src.finishStage(mfaStageName)
+			}
+			// A duration of 0 leaves it to the profile's duration_seconds, or to STS if that is unset
+			if duration != 0 {
+				o.Duration = duration
+			}
+
+			// role_session_name from the profile is also treated as a template
+			if sessionNameTemplate != "" {
+				o.RoleSessionName = sessionNameTemplate
+			}
+			if o.RoleSessionName != "" {
+				o.RoleSessionName = roleSessionName(o.RoleSessionName)
+			}
+			if sessionPolicy != "" {
+				o.Policy = aws.String(sessionPolicy)
+			}
+			// The innermost hop comes first, with the profile's source credentials
+			if client, ok := o.Client.(*sts.Client); ok && src.sourceCredentials == nil {
+				src.sourceCredentials = client.Options().Credentials
+			}
+			serialNumber := o.SerialNumber
+			if hops != nil {
+				hops.wrap(o)
+			}
+			o.Client = &assumeRoleClient{
+				AssumeRoleAPIClient: o.Client,
+				omitDuration:        o.Duration == 0,
+				beforeCall: func() error {
+					if err := src.finishStage(sourceStageName); err != nil {
+						return err
+					}
+					return src.finishStage(mfaStageName)
+				},
+			}
+			opts = *o // Save these because we need them later
+			// With -mfa-session the MFA moves to the user's session, but the role is cached
+			// under the same key as without it
+			opts.SerialNumber = serialNumber
+		}
+
+		credSource, credSourceProfile := profileCredentialSource(ctx)
+		if !cacheOnly {
+			if err := checkCredentialSource(credSource, credSourceProfile); err != nil {
+				return nil, err
+			}
+		}
+		// The SDK uses keys in the environment as they are, ignoring AWS_PROFILE, unless the
+		// profile is named explicitly. With credential_source Environment they are only the
+		// source credentials of the profile's role
+		sharedProfile := profile
+		if credSource != "" {
+			sharedProfile = profileOrDefault()
+		}
+
+		if noIMDS || cacheOnly {
+			disableMetadataFallbacks()
+		}
+
+		// The environment and profile take precedence, the same as they would in the SDK,
+		// but other sources are tried before assuming us-east-1
+		src.region, src.regionSource = resolveRegion(ctx)
+		if debugLog {
+			debugf("profile chain %s", strings.Join(profileChain(ctx), " -> "))
+			debugf("region %s from %s", src.region, src.regionSource)
+		}
+		if stsGlobalEndpoint && stsGlobalRegion(src.region) == "" {
+			return nil, fmt.Errorf("-sts-global-endpoint is only available in the aws partition, not for region %s", src.region)
+		}
+
+		optFns := []func(*config.LoadOptions) error{
+			config.WithRegion(src.region),
+
+			// optional profile name from ~/.aws/config
+			// empty value will be ignored, falling back on environment variables, etc
+			config.WithSharedConfigProfile(sharedProfile),
+
+			config.WithAssumeRoleCredentialOptions(configureAssumeRole),
+			config.WithCredentialsCacheOptions(func(o *aws.CredentialsCacheOptions) {
+				o.ExpiryWindow = expiryWindow
+			}),
+		}
+		if imdsDisabled() {
+			optFns = append(optFns, config.WithEC2IMDSClientEnableState(imds.ClientDisabled))
+		}
+		// Otherwise the profile and environment settings apply, the same as they would in the SDK
+		if retryMaxAttempts > 0 || retryMaxBackoff > 0 {
+			optFns = append(optFns, config.WithRetryer(newRetryer))
+		}
+		if caBundle != "" {
+			data, err := os.ReadFile(caBundle)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA bundle, %w", err)
+			}
+			optFns = append(optFns, config.WithCustomCABundle(bytes.NewReader(data)))
+		}
+		if useFIPSEndpoint {
+			optFns = append(optFns, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+		}
+		if useDualStackEndpoint {
+			optFns = append(optFns, config.WithUseDualStackEndpoint(aws.DualStackEndpointStateEnabled))
+		}
+
+		// Source credentials supplied outside of the shared config files (systemd, etc)
+		// take the place of the profile's source_profile
+		source, err := sourceCredentialsOverride()
+		if err != nil {
+			return nil, err
+		}
+		if source != nil {
+			optFns = append(optFns, config.WithCredentialsProvider(source))
+		}
+
+		cfg, err := config.LoadDefaultConfig(ctx, optFns...)
+		if err != nil {
+			return nil, err
+		}
+
+		if source != nil {
+			if err := assumeRoleFromSource(ctx, &cfg, configureAssumeRole); err != nil {
+				return nil, err
+			}
+		}
+
+		src.provider = cfg.Credentials
+		src.cacheKey = assumeRoleCacheKey(opts)
+	}
+
+	return src, nil
+}
+
+// selectProfile asks for the profile when none was given and the credentials aren't
+// only read from the cache, see pickMissingProfile. It has to come before the flag
+// defaults are applied, since they are read from the profile's settings
+func selectProfile() error {
+	if profile != "" || os.Getenv("AWS_PROFILE") != "" || cacheOnly {
+		return nil
+	}
+	if v, err := strconv.ParseBool(os.Getenv(flagEnvName("cache-only"))); err == nil && v {
+		return nil
+	}
+	picked, err := pickMissingProfile()
+	if err != nil {
+		return err
+	}
+	profile = picked
+	return nil
+}
+
+// profileOrDefault returns the name of the profile credentials are resolved for
+func profileOrDefault() string {
+	if profile != "" {
+		return profile
+	}
+	if v := os.Getenv("AWS_PROFILE"); v != "" {
+		return v
+	}
+	return "default"
+}
+
+// resolveCredentials loads credentials according to the credential flags, using
+// the cache unless disabled. The region the credentials were resolved for is also returned
+func resolveCredentials(ctx context.Context) (aws.Credentials, string, error) {
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return aws.Credentials{}, "", err
+	}
+
+	creds, err := src.load(ctx)
+	return creds, src.region, err
+}
+
+// cache returns the cache entry for the source's credentials
+func (src *credentialSource) cache() *CLICache {
+	return NewCache(src.provider, forceRefresh, dpapiCache, src.cacheKey)
+}
+
+// load retrieves the credentials through the profile's pipeline, see pipeline.go
+func (src *credentialSource) load(ctx context.Context) (aws.Credentials, error) {
+	start := time.Now()
+	names, err := pipeline()
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	ctx, stop := withResolveTimeout(ctx)
+	defer stop()
+
+	src.stats.cache = "disabled"
+	creds, err := src.runPipeline(ctx, names)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return creds, &timeoutError{resolveTimeout}
+		}
+		return creds, err
+	}
+	// Always the final check, regardless of the pipeline, unless -max-stale allowed them
+	if src.stats.cache != "stale" {
+		if err := checkExpiration(creds); err != nil {
+			return creds, err
+		}
+	}
+	src.stats.elapsed = time.Since(start)
+	debugf("resolved credentials in %s, cache %s", src.stats.elapsed.Round(time.Millisecond), src.stats.cache)
+	return creds, nil
+}
+
+// accountID returns the account the credentials belong to, which is the account of the
+// role when one was assumed. Otherwise it is only looked up with -account-id, since that
+// takes a call to STS. Failures leave the account unset rather than failing the request
+func (src *credentialSource) accountID(ctx context.Context, creds aws.Credentials) string {
+	if parsed, err := arn.Parse(src.cacheKey.RoleArn); err == nil {
+		return parsed.AccountID
+	}
+	if !lookupAccountID || cacheOnly {
+		return ""
+	}
+	client := sts.New(sts.Options{
+		Credentials: credentials.StaticCredentialsProvider{Value: creds},
+		Region:      src.region,
+	}, withSTSOptions)
+	out, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return ""
+	}
+	return aws.ToString(out.Account)
+}
+
+// fatal logs the error and exits, with a status specific to the error where there is one
+func fatal(err error) {
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
+	var expiredErr *expiredCredentialsError
+	if errors.As(err, &expiredErr) {
+		log.Print(err)
+		os.Exit(exitCodeExpired)
+	}
+	var timeoutErr *timeoutError
+	if errors.As(err, &timeoutErr) {
+		log.Print(err)
+		os.Exit(exitCodeTimeout)
+	}
+	log.Fatal(err)
+}
+
+func main() {
+	handleSignals()
+	ctx := context.Background()
+
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd.run(ctx, cmd.flagSet(), os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
+		}
+	}
+
+	flag.Parse()
+	if flag.NArg() > 0 {
+		// e.g. a command left out of the minimal build
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
+	// Clearing the variables doesn't need a profile
+	if outputName != "env-unset" {
+		if err := selectProfile(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := applyFlagDefaults(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	if err := setupLogging(); err != nil {
+		log.Fatal(err)
+	}
+
+	out, err := lookupOutput(ctx, outputName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Clearing the variables from a shell shouldn't require credentials, or an MFA prompt
+	if outputName == "env-unset" {
+		if err := out.Write(os.Stdout, aws.Credentials{}, ""); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if outputQuery != "" {
+		if out, err = output.Query(out, outputQuery); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if encryptTo != "" {
+		if err := validateEncryptTo(encryptTo); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if watchMode && outFile == "" && systemdCredOut == "" {
+		log.Fatal("-watch requires -out or -systemd-credential-out")
+	}
+
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	write := func(creds aws.Credentials) error {
+		if resolveStatsTrailer {
+			fmt.Fprintln(os.Stderr, strings.Join(src.stats.env(), " "))
+		}
+		if systemdCredOut != "" {
+			if err := writeSystemdCredential(systemdCredOut, creds, systemdCredEncrypt); err != nil {
+				return err
+			}
+		}
+		return writeOutput(out, creds, src.region, outFile, encryptTo)
+	}
+
+	if watchMode {
+		if err := watchCredentials(ctx, src, write); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	creds, err := src.load(ctx)
+	if err != nil {
+		fatal(err)
+	}
+	if err := write(creds); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/ryandeivert/aws-cred-proc/pkg/cache"
+)
+
+// countingProvider returns new credentials valid for an hour, counting the calls
+type countingProvider struct {
+	calls int
+}
+
+func (p *countingProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	p.calls++
+	return aws.Credentials{
+		AccessKeyID:     "ASIANEW",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		CanExpire:       true,
+		Expires:         time.Now().Add(time.Hour).Truncate(time.Second),
+	}, nil
+}
+
+// roundTripperFunc answers HTTP requests without a server
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// useMemoryCache keeps the cache entries in memory for the rest of the test
+func useMemoryCache(t *testing.T) *cache.MemoryBackend {
+	t.Helper()
+	backend := cache.NewMemoryBackend()
+	prev := cacheBackend
+	cacheBackend = backend
+	t.Cleanup(func() { cacheBackend = prev })
+	return backend
+}
+
+// newTestCache returns a cache of key in its own memory backend
+func newTestCache(t *testing.T, key computableCacheKey) (*CLICache, *countingProvider, *cache.MemoryBackend) {
+	t.Helper()
+	backend := useMemoryCache(t)
+
+	provider := &countingProvider{}
+	return NewCache(provider, false, false, key), provider, backend
+}
+
+// useConfig points the shared config file at one with content and selects the profile,
+// for the rest of the test
+func useConfig(t *testing.T, name, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", path)
+	prev := profile
+	profile = name
+	t.Cleanup(func() { profile = prev })
+}
+
+// resetCredentialFlags puts the credential flags and the cache backend back to their
+// defaults once the test is done, for tests that run commands with their own flags
+func resetCredentialFlags(t *testing.T) {
+	t.Helper()
+	prevFlags, prevBackend := credentialFlags, cacheBackend
+	t.Cleanup(func() {
+		addCredentialFlags(flag.NewFlagSet("reset", flag.ContinueOnError))
+		credentialFlags, cacheBackend = prevFlags, prevBackend
+	})
+}
+
+func decodeTestEntry(t *testing.T, backend cache.Backend, name string) *cache.Item {
+	t.Helper()
+	data, err := backend.Get(name)
+	if err != nil {
+		t.Fatalf("no entry %s, %v", name, err)
+	}
+	item, err := cache.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func TestCLICacheEntryNames(t *testing.T) {
+	role := computableCacheKey{RoleArn: "arn:aws:iam::123456789012:role/Dev"}
+	wrapped := computableCacheKey{WrapCommand: "other-tool --profile dev"}
+	tests := []struct {
+		name        string
+		key         computableCacheKey
+		entry       string
+		wantVersion int
+		wantKey     bool
+	}{
+		// The aws CLI computes the same name and reads the entry, so it stays as it writes them
+		{"assumed role", role, role.String() + ".json", 0, false},
+		{"tool-native", wrapped, wrapped.String() + ".v1.json", cache.SchemaVersion, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, provider, backend := newTestCache(t, tt.key)
+			if _, err := c.Load(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if c.name() != tt.entry {
+				t.Errorf("name() = %s, want %s", c.name(), tt.entry)
+			}
+			item := decodeTestEntry(t, backend, tt.entry)
+			if item.SchemaVersion != tt.wantVersion {
+				t.Errorf("SchemaVersion = %d, want %d", item.SchemaVersion, tt.wantVersion)
+			}
+			if (item.Key != nil) != tt.wantKey {
+				t.Errorf("entry has key %v, want a key: %v", item.Key, tt.wantKey)
+			}
+
+			// And it's read back rather than refreshed
+			if _, err := c.Load(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if provider.calls != 1 {
+				t.Errorf("retrieved %d times, want 1", provider.calls)
+			}
+		})
+	}
+}
+
+func TestCLICacheMigratesToolNative(t *testing.T) {
+	key := computableCacheKey{PolicyHash: cache.PolicyHash(`{}`), RoleArn: "arn:aws:iam::123456789012:role/Dev"}
+	creds := aws.Credentials{
+		AccessKeyID:     "ASIAOLD",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		CanExpire:       true,
+		Expires:         time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+	sha256Key := key.hashed(cacheKeyHashSHA256)
+
+	tests := []struct {
+		name   string
+		legacy string
+		item   func() *cache.Item
+	}{
+		{
+			// Written before tool-native entries were versioned
+			name:   "unversioned",
+			legacy: key.String() + ".json",
+			item:   func() *cache.Item { return cache.NewItem(creds) },
+		},
+		{
+			name:   "other cache key hash",
+			legacy: sha256Key + ".v1.json",
+			item: func() *cache.Item {
+				item := cache.NewItem(creds)
+				item.SchemaVersion = cache.SchemaVersion
+				return item
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, provider, backend := newTestCache(t, key)
+			data, err := json.Marshal(tt.item())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := backend.Put(tt.legacy, data); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := c.Load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.AccessKeyID != "ASIAOLD" || provider.calls != 0 {
+				t.Errorf("Load = %s after %d retrieves, want the migrated ASIAOLD", got.AccessKeyID, provider.calls)
+			}
+			item := decodeTestEntry(t, backend, c.name())
+			if item.SchemaVersion != cache.SchemaVersion || item.Key == nil || item.Key.PolicyHash != key.PolicyHash {
+				t.Errorf("migrated entry has schema version %d and key %+v", item.SchemaVersion, item.Key)
+			}
+			// Left for older binaries
+			if _, err := backend.Get(tt.legacy); err != nil {
+				t.Errorf("legacy entry was removed, %v", err)
+			}
+		})
+	}
+}
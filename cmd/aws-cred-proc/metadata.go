@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// Environment variables the SDK uses to locate ECS/EKS container credentials
+var containerCredentialEnvVars = []string{
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+}
+
+// imdsDisabled reports whether the EC2 instance metadata service should be skipped,
+// either because of the -no-imds flag or the standard AWS_EC2_METADATA_DISABLED opt-out
+func imdsDisabled() bool {
+	return noIMDS || strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true")
+}
+
+// disableMetadataFallbacks removes the container credential settings and sets the
+// standard IMDS opt-out, so neither the SDK nor any child process started by this
+// one (MFA helpers, cleanup processes, etc) waits on metadata endpoints off-cloud
+func disableMetadataFallbacks() {
+	os.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	for _, key := range containerCredentialEnvVars {
+		os.Unsetenv(key)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mattn/go-tty"
+	"github.com/ryandeivert/aws-cred-proc/pkg/mfa"
+)
+
+// tokenProvider returns the MFA token provider selected by the credential flags
+// for the given MFA device, or by the profile. TTYPrompt is used when no other provider is selected
+func tokenProvider(mfaSerial *string) func() (string, error) {
+	name, provider := selectTokenProvider(mfaSerial)
+	return func() (string, error) {
+		debugf("reading the MFA code for %s with %s", aws.ToString(mfaSerial), name)
+		// The terminal running -watch is likely out of sight by the time it refreshes. The
+		// YubiKey provider sends its own notification to touch the key
+		if watchMode && !noNotify && name != "yubikey" {
+			desktopNotify("aws-cred-proc", fmt.Sprintf("Enter the MFA code to refresh the credentials for profile %s", profileOrDefault()))
+		}
+		return provider()
+	}
+}
+
+// selectTokenProvider returns the token provider selected by the flags, and its name
+func selectTokenProvider(mfaSerial *string) (string, func() (string, error)) {
+	switch {
+	case mfaYK:
+		return "yubikey", MFAYKCode(mfaSerial)
+	case mfaTOTP:
+		return "totp", TOTPCode(mfaSerial)
+	case mfaOPItem != "":
+		return "1password", OnePasswordCode(mfaOPItem)
+	case mfaBWItem != "":
+		return "bitwarden", BitwardenCode(mfaBWItem)
+	case mfaPassEntry != "":
+		return mfaPassCommand, PassCode(mfaPassCommand, mfaPassEntry)
+	case mfaProcess != "":
+		return mfaProcessSetting, ProcessCode(mfaProcess, mfaSerial)
+	case mfaPinentry:
+		return "pinentry", PinentryCode(pinentryProgram, mfaSerial)
+	case askPassword:
+		return "systemd-ask-password", AskPasswordCode(mfaSerial)
+	case profileSetting(mfaProcessSetting) != "":
+		return mfaProcessSetting, ProcessCode(profileSetting(mfaProcessSetting), mfaSerial)
+	case profileSetting(passTOTPSeedSetting) != "":
+		return passTOTPSeedSetting, PassTOTPCode(profileSetting(passTOTPSeedSetting))
+	default:
+		return "tty prompt", TTYPrompt
+	}
+}
+
+// promptPassword reads a passphrase without echoing it, from the TTY or through
+// systemd-ask-password with -ask-password. id identifies the prompt to password agents
+func promptPassword(id, prompt string) (string, error) {
+	if askPassword {
+		return systemdAskPassword(id, prompt)
+	}
+
+	tty, err := tty.Open()
+	if err != nil {
+		return "", err
+	}
+	defer tty.Close()
+	defer onAbort(func() { tty.Close() })()
+
+	fmt.Fprint(tty.Output(), prompt+" ")
+	return tty.ReadPassword()
+}
+
+// ProcessCode runs a command, from -mfa-process or mfa_process, that prints the MFA
+// token to stdout. Like credential_process helpers it can prompt on the terminal, and
+// it's passed the MFA device and profile in the environment. It runs with the shell, the
+// same as credential_process, so it can quote arguments
+func ProcessCode(command string, mfaSerial *string) func() (string, error) {
+	process := mfa.Process(command,
+		"AWS_CRED_PROC_MFA_SERIAL="+aws.ToString(mfaSerial),
+		"AWS_CRED_PROC_PROFILE="+profileOrDefault(),
+	)
+	return func() (string, error) {
+		code, err := process()
+		if err != nil {
+			return "", fmt.Errorf("%s, %w", mfaProcessSetting, err)
+		}
+		return code, nil
+	}
+}
+
+// OnePasswordCode reads the current one-time password for an item using the 1Password CLI
+func OnePasswordCode(item string) func() (string, error) {
+	return mfa.OnePassword(item)
+}
+
+// PassCode reads the current one-time password for an entry in the standard Unix
+// password store using the pass-otp extension, or the gopass equivalent
+func PassCode(command, entry string) func() (string, error) {
+	return mfa.Pass(command, entry)
+}
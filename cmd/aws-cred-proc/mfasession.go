@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// mfaSessionDuration is how long the IAM user's MFA session lasts, set with -mfa-session.
+// 0 passes the MFA to each AssumeRole call instead
+var mfaSessionDuration time.Duration
+
+// The durations GetSessionToken accepts
+const (
+	minMFASession = 15 * time.Minute
+	maxMFASession = 36 * time.Hour
+)
+
+// mfaSessionFlag is a flag.Value for -mfa-session, which rejects durations STS would
+type mfaSessionFlag struct {
+	duration *time.Duration
+}
+
+func (f mfaSessionFlag) String() string {
+	if f.duration == nil {
+		return ""
+	}
+	return f.duration.String()
+}
+
+func (f mfaSessionFlag) Set(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if d != 0 && (d < minMFASession || d > maxMFASession) {
+		return fmt.Errorf("the MFA session must be 0 (disabled) or between %s and %s", minMFASession, maxMFASession)
+	}
+	*f.duration = d
+	return nil
+}
+
+// useMFASession moves the MFA of the role's options to a GetSessionToken session of the
+// IAM user, cached on its own, then assumes the role with that session. Roles trusting
+// aws:MultiFactorAuthPresent accept it the same, so every role the user assumes shares
+// the one MFA prompt until the session expires
+func useMFASession(o *stscreds.AssumeRoleOptions, client *sts.Client) {
+	provider := mfaSessionProvider{
+		client:        client,
+		serialNumber:  aws.ToString(o.SerialNumber),
+		tokenProvider: o.TokenProvider,
+	}
+	key := computableCacheKey{
+		DurationSeconds: int(mfaSessionDuration.Seconds()),
+		MFASession:      true,
+		SerialNumber:    provider.serialNumber,
+	}
+	o.Client = sts.New(client.Options(), func(so *sts.Options) {
+		so.Credentials = aws.NewCredentialsCache(hopCacheProvider(provider, key))
+	})
+	o.SerialNumber = nil
+	o.TokenProvider = nil
+}
+
+// mfaSessionProvider gets a session for the IAM user whose keys the client has, with MFA
+type mfaSessionProvider struct {
+	client        *sts.Client
+	serialNumber  string
+	tokenProvider func() (string, error)
+}
+
+func (p mfaSessionProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	code, err := p.tokenProvider()
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("failed to get MFA token, %w", err)
+	}
+	out, err := p.client.GetSessionToken(ctx, &sts.GetSessionTokenInput{
+		DurationSeconds: aws.Int32(int32(mfaSessionDuration.Seconds())),
+		SerialNumber:    aws.String(p.serialNumber),
+		TokenCode:       aws.String(code),
+	}, stsCallOptions()...)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("failed to get MFA session, %w", err)
+	}
+	return aws.Credentials{
+		AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		Source:          "GetSessionToken",
+		CanExpire:       true,
+		Expires:         aws.ToTime(out.Credentials.Expiration),
+	}, nil
+}
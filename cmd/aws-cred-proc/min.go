@@ -0,0 +1,111 @@
+//go:build credproc_min
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/ryandeivert/aws-cred-proc/pkg/cache"
+)
+
+// The minimal build (make build-min) only resolves credentials from the shared config,
+// assumes roles and caches them, leaving out the commands and the integrations that
+// need hardware, cgo or other programs. Their flags are still accepted, so the same
+// credential_process line works with either build, but fail when used
+
+func errNotInMinimalBuild(feature string) error {
+	return fmt.Errorf("%s is not available in the minimal build", feature)
+}
+
+func unavailableTokenProvider(flag string) func() (string, error) {
+	return func() (string, error) {
+		return "", errNotInMinimalBuild(flag)
+	}
+}
+
+func MFAYKCode(mfaSerial *string) func() (string, error) {
+	return unavailableTokenProvider("-mfa-yk")
+}
+
+func TOTPCode(mfaSerial *string) func() (string, error) {
+	return unavailableTokenProvider("-mfa-totp")
+}
+
+func BitwardenCode(item string) func() (string, error) {
+	return unavailableTokenProvider("-mfa-bw")
+}
+
+func PinentryCode(program string, mfaSerial *string) func() (string, error) {
+	return unavailableTokenProvider("-mfa-pinentry")
+}
+
+func PassTOTPCode(entry string) func() (string, error) {
+	return unavailableTokenProvider(passTOTPSeedSetting)
+}
+
+func passSourceCredentials(entry string) (aws.CredentialsProvider, error) {
+	return nil, errNotInMinimalBuild(passCredentialsSetting)
+}
+
+func dialogPrompt() (string, error) {
+	return "", errNotInMinimalBuild("prompting without a tty")
+}
+
+func newCognitoSource() (*credentialSource, error) {
+	return nil, errNotInMinimalBuild("-cognito-pool")
+}
+
+func newKeyringCacheBackend() (cache.Backend, error) {
+	return nil, errNotInMinimalBuild("-cache-backend keyring")
+}
+
+const dpapiSupported = false
+
+func dpapiProtect(data []byte) ([]byte, error) {
+	return nil, errNotInMinimalBuild("-dpapi")
+}
+
+func dpapiUnprotect(data []byte) ([]byte, error) {
+	return nil, errNotInMinimalBuild("-dpapi")
+}
+
+func helloVerify(profile string) error {
+	return errNotInMinimalBuild("-windows-hello")
+}
+
+func attest(ctx context.Context, params *sts.AssumeRoleInput) error {
+	return errNotInMinimalBuild("-attestation-cmd")
+}
+
+func systemdSourceCredentials() (aws.CredentialsProvider, error) {
+	return nil, errNotInMinimalBuild("-systemd-creds")
+}
+
+func writeSystemdCredential(name string, creds aws.Credentials, encrypt bool) error {
+	return errNotInMinimalBuild("-systemd-credential-out")
+}
+
+func AskPasswordCode(mfaSerial *string) func() (string, error) {
+	return unavailableTokenProvider("-ask-password")
+}
+
+func systemdAskPassword(id, prompt string) (string, error) {
+	return "", errNotInMinimalBuild("-ask-password")
+}
+
+func newWrapSource(ctx context.Context) (*credentialSource, error) {
+	return nil, errNotInMinimalBuild("-wrap")
+}
+
+func watchCredentials(ctx context.Context, src *credentialSource, write func(aws.Credentials) error) error {
+	return errNotInMinimalBuild("-watch")
+}
+
+func desktopNotify(title, message string) {}
+
+func pickMissingProfile() (string, error) {
+	return "", nil
+}
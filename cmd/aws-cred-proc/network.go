@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// caBundleClient is the HTTP client for the calls not made through the clients of the
+// loaded config, when a CA bundle is configured. It is set by loadCABundle
+var caBundleClient *http.Client
+
+// caBundlePath returns the PEM file of extra CAs to trust: -ca-bundle, or else
+// AWS_CA_BUNDLE or the profile's ca_bundle, the same as the SDK
+func caBundlePath(ctx context.Context) string {
+	if caBundle != "" {
+		return caBundle
+	}
+	if v := os.Getenv("AWS_CA_BUNDLE"); v != "" {
+		return v
+	}
+	shared, err := loadSharedProfile(ctx, profileOrDefault())
+	if err != nil {
+		return ""
+	}
+	return shared.CustomCABundle
+}
+
+// loadCABundle reads the CA bundle, if there is one, and sets up caBundleClient to
+// trust it along with the system's CAs. Like http.DefaultClient and the SDK's clients,
+// the client uses the proxy from HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+func loadCABundle(ctx context.Context) error {
+	path := caBundlePath(ctx)
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read CA bundle, %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	caBundleClient = &http.Client{Transport: transport}
+	return nil
+}
+
+// httpClient returns the client for HTTP calls made outside of the SDK's clients
+func httpClient() *http.Client {
+	if caBundleClient != nil {
+		return caBundleClient
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,16 @@
+//go:build !credproc_min
+
+package main
+
+import "os/exec"
+
+// desktopNotify shows a notification through Notification Center. The text is passed
+// as arguments to the script so it never needs to be quoted for AppleScript
+func desktopNotify(title, message string) {
+	cmd := exec.Command("osascript",
+		"-e", "on run argv",
+		"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+		"-e", "end run",
+		title, message)
+	go cmd.Run()
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !windows && !credproc_min
+
+package main
+
+import "os/exec"
+
+// desktopNotify shows a notification with notify-send from libnotify. Headless
+// machines usually don't have it, so failures are ignored
+func desktopNotify(title, message string) {
+	cmd := exec.Command("notify-send", "--app-name=aws-cred-proc", title, message)
+	go cmd.Run()
+}
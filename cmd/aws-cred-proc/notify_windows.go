@@ -0,0 +1,24 @@
+//go:build !credproc_min
+
+package main
+
+import "os/exec"
+
+// The toast is shown under the PowerShell app id, since Windows drops toasts from app ids
+// that are not registered. The text is passed in the environment to avoid quoting it
+const notifyScript = `
+$null = [Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType=WindowsRuntime]
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$null = $text.Item(0).AppendChild($xml.CreateTextNode($env:AWS_CRED_PROC_NOTIFY_TITLE))
+$null = $text.Item(1).AppendChild($xml.CreateTextNode($env:AWS_CRED_PROC_NOTIFY_MESSAGE))
+$appId = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($appId).Show([Windows.UI.Notifications.ToastNotification]::new($xml))
+`
+
+// desktopNotify shows a toast notification
+func desktopNotify(title, message string) {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", notifyScript)
+	cmd.Env = append(cmd.Environ(), "AWS_CRED_PROC_NOTIFY_TITLE="+title, "AWS_CRED_PROC_NOTIFY_MESSAGE="+message)
+	go cmd.Run()
+}
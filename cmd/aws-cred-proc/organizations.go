@@ -0,0 +1,117 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// organizationsRegions are the regions the Organizations endpoint of each partition is
+// in, which requests are signed for
+var organizationsRegions = map[string]string{
+	partitionAWS:      "us-east-1",
+	partitionAWSUSGov: "us-gov-west-1",
+	partitionAWSCN:    "cn-northwest-1",
+}
+
+// orgAccount is an account of an AWS Organization, as ListAccounts returns it
+type orgAccount struct {
+	Id     string
+	Name   string
+	Email  string
+	Status string
+}
+
+// listOrgAccounts returns the active accounts of the organization the credentials belong
+// to, sorted by name. The credentials need organizations:ListAccounts, so usually come
+// from the management account or a delegated administrator
+func listOrgAccounts(ctx context.Context, creds aws.Credentials, region string) ([]orgAccount, error) {
+	var accounts []orgAccount
+	var nextToken string
+	for {
+		var out struct {
+			Accounts  []orgAccount
+			NextToken string
+		}
+		input := map[string]string{}
+		if nextToken != "" {
+			input["NextToken"] = nextToken
+		}
+		if err := callOrganizations(ctx, creds, region, "ListAccounts", input, &out); err != nil {
+			return nil, err
+		}
+		for _, account := range out.Accounts {
+			if account.Status == "ACTIVE" {
+				accounts = append(accounts, account)
+			}
+		}
+		if nextToken = out.NextToken; nextToken == "" {
+			break
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+	return accounts, nil
+}
+
+// callOrganizations makes a signed call to the Organizations API of the region's
+// partition. The service speaks JSON 1.1, like Cognito, so it's called directly rather
+// than through another SDK module
+func callOrganizations(ctx context.Context, creds aws.Credentials, region, operation string, input, output any) error {
+	partition := regionPartition(region)
+	signingRegion, ok := organizationsRegions[partition]
+	if !ok {
+		return fmt.Errorf("AWS Organizations is not available in partition %s", partition)
+	}
+
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to encode organizations %s request, %w", operation, err)
+	}
+	url := fmt.Sprintf("https://organizations.%s.%s/", signingRegion, partitionDNSSuffix(partition))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSOrganizationsV20161128."+operation)
+
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "organizations", signingRegion, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign organizations %s request, %w", operation, err)
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call organizations %s, %w", operation, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read organizations %s response, %w", operation, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"Message"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		return fmt.Errorf("organizations %s failed (%d): %s %s", operation, resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+	if err := json.Unmarshal(data, output); err != nil {
+		return fmt.Errorf("failed to decode organizations %s response, %w", operation, err)
+	}
+	return nil
+}
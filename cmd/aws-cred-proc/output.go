@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/ryandeivert/aws-cred-proc/pkg/output"
+)
+
+// k8sCluster is the EKS cluster name the -output k8s-exec token is for
+var k8sCluster string
+
+// outputTemplate is the text of the -output template format
+var outputTemplate string
+
+// outputOptions are the inputs of the formats that need more than the credentials
+func outputOptions(ctx context.Context) output.Options {
+	return output.Options{
+		Profile:    profileOrDefault(),
+		Template:   outputTemplate,
+		K8sCluster: k8sCluster,
+		Context:    ctx,
+		STSOptions: []func(*sts.Options){withSTSOptions},
+	}
+}
+
+// lookupOutput returns the -output format with the name, checking the flags it needs.
+// The format is looked up again as it writes, since the profile may be picked later
+func lookupOutput(ctx context.Context, name string) (output.Output, error) {
+	if !slices.Contains(output.Names(), name) {
+		return nil, fmt.Errorf("unknown -output %q, expected one of: %s", name, strings.Join(output.Names(), ", "))
+	}
+	switch {
+	case name == "template" && outputTemplate == "":
+		return nil, fmt.Errorf("-output template requires -template")
+	case name == "k8s-exec" && k8sCluster == "":
+		return nil, fmt.Errorf("-output k8s-exec requires -k8s-cluster")
+	}
+	if _, err := output.Lookup(name, outputOptions(ctx)); err != nil {
+		return nil, err
+	}
+	return output.Func(func(w io.Writer, creds aws.Credentials, region string) error {
+		out, err := output.Lookup(name, outputOptions(ctx))
+		if err != nil {
+			return err
+		}
+		return out.Write(w, creds, region)
+	}), nil
+}
+
+// writeOutput writes the credentials in the output's format to stdout, or atomically to
+// the file at path if it is set. The output is first encrypted for encryptTo, if it is set
+func writeOutput(out output.Output, creds aws.Credentials, region, path, encryptTo string) error {
+	if path == "" && encryptTo == "" {
+		return out.Write(os.Stdout, creds, region)
+	}
+	var buf bytes.Buffer
+	if err := out.Write(&buf, creds, region); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	if encryptTo != "" {
+		var err error
+		if data, err = encryptOutput(encryptTo, data); err != nil {
+			return err
+		}
+	}
+
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write %s, %w", path, err)
+	}
+	return nil
+}
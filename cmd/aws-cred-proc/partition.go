@@ -0,0 +1,53 @@
+package main
+
+import "strings"
+
+// Partitions with their own endpoints, credentials and ARNs. A role in one can't be
+// assumed through the STS endpoints of another
+const (
+	partitionAWS      = "aws"
+	partitionAWSUSGov = "aws-us-gov"
+	partitionAWSCN    = "aws-cn"
+	partitionAWSISO   = "aws-iso"
+	partitionAWSISOB  = "aws-iso-b"
+)
+
+// partitionDefaultRegions are used in place of us-east-1 for roles in other partitions
+// when the region can't be resolved from anywhere else
+var partitionDefaultRegions = map[string]string{
+	partitionAWS:      defaultRegion,
+	partitionAWSUSGov: "us-gov-west-1",
+	partitionAWSCN:    "cn-north-1",
+	partitionAWSISO:   "us-iso-east-1",
+	partitionAWSISOB:  "us-isob-east-1",
+}
+
+// regionPartition returns the partition the region belongs to
+func regionPartition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "us-gov-"):
+		return partitionAWSUSGov
+	case strings.HasPrefix(region, "cn-"):
+		return partitionAWSCN
+	case strings.HasPrefix(region, "us-isob-"):
+		return partitionAWSISOB
+	case strings.HasPrefix(region, "us-iso-"):
+		return partitionAWSISO
+	default:
+		return partitionAWS
+	}
+}
+
+// partitionDNSSuffix returns the domain of the partition's regional service endpoints
+func partitionDNSSuffix(partition string) string {
+	switch partition {
+	case partitionAWSCN:
+		return "amazonaws.com.cn"
+	case partitionAWSISO:
+		return "c2s.ic.gov"
+	case partitionAWSISOB:
+		return "sc2s.sgov.gov"
+	default:
+		return "amazonaws.com"
+	}
+}
@@ -0,0 +1,118 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/ryandeivert/aws-cred-proc/pkg/mfa"
+)
+
+// passCommand is the password store command for the profile, which can be set with
+// pass_command in the profile to override -mfa-pass-cmd
+func passCommand() (string, error) {
+	command := mfaPassCommand
+	if v := profileSetting(passCommandSetting); v != "" {
+		command = v
+	}
+	if command != "pass" && command != "gopass" {
+		return "", fmt.Errorf("unsupported password store command %q, expected pass or gopass", command)
+	}
+	return command, nil
+}
+
+// passShow decrypts an entry of the password store, which may prompt for the gpg passphrase
+func passShow(entry string) ([]string, error) {
+	command, err := passCommand()
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(command, "show", entry)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s show %s failed, %w: %s", command, entry, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n"), nil
+}
+
+// passSourceCredentials reads static source credentials from a password store entry.
+// The entry holds aws_access_key_id, aws_secret_access_key and optional aws_session_token
+// lines, as "key: value" or "key = value". Following the pass convention of keeping the
+// password on the first line, the secret access key may instead be the first line. The
+// entry is only read once the credentials are needed, so a cache hit doesn't unlock the
+// store or touch a GPG smart card
+func passSourceCredentials(entry string) (aws.CredentialsProvider, error) {
+	return aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return readPassCredentials(entry)
+	}), nil
+}
+
+func readPassCredentials(entry string) (aws.Credentials, error) {
+	lines, err := passShow(entry)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	values := map[string]string{}
+	for _, line := range lines {
+		if i := strings.IndexAny(line, ":="); i > 0 {
+			values[strings.ToLower(strings.TrimSpace(line[:i]))] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	if _, ok := values["aws_secret_access_key"]; !ok {
+		values["aws_secret_access_key"] = strings.TrimSpace(lines[0])
+	}
+
+	accessKey, secretKey := values["aws_access_key_id"], values["aws_secret_access_key"]
+	if accessKey == "" || secretKey == "" {
+		return aws.Credentials{}, fmt.Errorf("password store entry %s does not have an aws_access_key_id and aws_secret_access_key", entry)
+	}
+	return aws.Credentials{
+		AccessKeyID:     accessKey,
+		SecretAccessKey: secretKey,
+		SessionToken:    values["aws_session_token"],
+		Source:          credentials.StaticCredentialsName,
+	}, nil
+}
+
+// passTOTPSeed finds the seed in a password store entry, either in an otpauth:// URI
+// like the pass-otp extension stores, or as the base32 seed on the first line
+func passTOTPSeed(lines []string) (string, error) {
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "otpauth://") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil {
+			return "", fmt.Errorf("invalid otpauth URI, %w", err)
+		}
+		return u.Query().Get("secret"), nil
+	}
+	return lines[0], nil
+}
+
+// PassTOTPCode computes the MFA code from a TOTP seed kept in a password store entry
+func PassTOTPCode(entry string) func() (string, error) {
+	return func() (string, error) {
+		lines, err := passShow(entry)
+		if err != nil {
+			return "", err
+		}
+		seed, err := passTOTPSeed(lines)
+		if err != nil {
+			return "", err
+		}
+		return mfa.TOTPSeed(seed)()
+	}
+}
@@ -0,0 +1,146 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ryandeivert/aws-cred-proc/internal/shell"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "pick",
+		usage: "interactively choose a profile on the terminal and print its credentials as environment variables, e.g. for the shell-init widget",
+		run:   runPick,
+	})
+	registerCommand(&command{
+		name:  "shell-init",
+		usage: "print a bash or zsh widget that binds Ctrl-A to pick and sets the chosen profile's credentials in the current shell, e.g. eval \"$(aws-cred-proc shell-init zsh)\"",
+		run:   runShellInit,
+	})
+}
+
+// configProfiles returns the names of the profiles in the shared config file
+func configProfiles() ([]string, error) {
+	cfg, err := loadINI(sharedConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	var profiles []string
+	for _, section := range cfg.sections() {
+		if section == "default" || strings.HasPrefix(section, "profile ") {
+			profiles = append(profiles, profileFromSection(section))
+		}
+	}
+	return profiles, nil
+}
+
+// pickProfile prompts on the terminal, since stdout is captured by the widget
+func pickProfile() (string, error) {
+	profiles, err := configProfiles()
+	if err != nil {
+		return "", err
+	}
+	if len(profiles) == 0 {
+		return "", fmt.Errorf("no profiles found in %s", sharedConfigPath())
+	}
+
+	def := 0
+	for i, name := range profiles {
+		if name == os.Getenv("AWS_CRED_PROC_PICKED") {
+			def = i
+		}
+	}
+	choice, err := fuzzyPick("Profile", profiles, def)
+	if err != nil {
+		return "", err
+	}
+	return profiles[choice], nil
+}
+
+// pickMissingProfile lets a person at a terminal choose the profile when none was given,
+// rather than silently using the default one. It returns "" when stdin or stderr isn't a
+// terminal, as when the aws CLI runs the credential_process, or when stdout is a pipe,
+// since SDKs run it with the terminal's stdin and stderr but read the credentials from
+// a pipe, and nobody would see the prompt. It also returns "" when the config has no
+// profiles to choose from
+func pickMissingProfile() (string, error) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stderr) || isPipe(os.Stdout) {
+		return "", nil
+	}
+	if profiles, err := configProfiles(); err != nil || len(profiles) < 2 {
+		return "", nil
+	}
+	return pickProfile()
+}
+
+func runPick(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	addCredentialFlags(fs)
+	fs.StringVar(&outputName, "output", "env", "the output `format`, see the -output flag")
+	fs.Parse(args)
+
+	out, err := lookupOutput(ctx, outputName)
+	if err != nil {
+		return err
+	}
+
+	picked, err := pickProfile()
+	if err != nil {
+		return err
+	}
+	profile = picked
+
+	creds, region, err := resolveCredentials(ctx)
+	if err != nil {
+		return err
+	}
+	if err := out.Write(os.Stdout, creds, region); err != nil {
+		return err
+	}
+	// Remembered by the shell so the next pick defaults to the same profile
+	if outputName == "env" {
+		fmt.Printf("\nexport AWS_CRED_PROC_PICKED=%s\n", shell.Quote(picked))
+	}
+	return nil
+}
+
+// shellWidgets are run in the current shell, so the exports printed by pick
+// are evaluated there directly rather than going through the history
+var shellWidgets = map[string]string{
+	"bash": `__aws_cred_proc_pick() {
+  local exports
+  exports="$(%[1]s pick </dev/tty)" && eval "$exports"
+}
+bind -x '"\C-a": __aws_cred_proc_pick'
+`,
+	"zsh": `__aws_cred_proc_pick() {
+  local exports
+  exports="$(%[1]s pick </dev/tty)" && eval "$exports"
+  zle reset-prompt
+}
+zle -N __aws_cred_proc_pick
+bindkey '^A' __aws_cred_proc_pick
+`,
+}
+
+func runShellInit(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+
+	name := fs.Arg(0)
+	widget, ok := shellWidgets[name]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q, expected bash or zsh", name)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable, %w", err)
+	}
+	_, err = fmt.Printf(widget, shell.Quote(exe))
+	return err
+}
@@ -0,0 +1,222 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	"github.com/aws/aws-sdk-go-v2/service/sso/types"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "pick-account",
+		usage: "interactively search the accounts of the AWS Organization, or with -sso the accounts and roles the profile's SSO session can use, and print credentials for the chosen one without adding it to the config file",
+		run:   runPickAccount,
+	})
+}
+
+func runPickAccount(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageRoleName = "the `name` of the role to assume in the chosen Organizations account"
+		usageSSO      = "list the accounts and roles of the profile's sso_start_url or sso_session, which needs a current aws sso login, instead of the Organizations accounts"
+	)
+	var roleName string
+	var useSSO bool
+
+	addCredentialFlags(fs)
+	fs.StringVar(&roleName, "role-name", "OrganizationAccountAccessRole", usageRoleName)
+	fs.BoolVar(&useSSO, "sso", false, usageSSO)
+	fs.StringVar(&outputName, "output", "env", "the output `format`, see the -output flag")
+	fs.Parse(args)
+
+	out, err := lookupOutput(ctx, outputName)
+	if err != nil {
+		return err
+	}
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	var creds aws.Credentials
+	if useSSO {
+		creds, err = pickSSORole(ctx)
+	} else {
+		creds, err = pickOrgAccount(ctx, src, roleName)
+	}
+	if err != nil {
+		return err
+	}
+	return out.Write(os.Stdout, creds, src.region)
+}
+
+// pickOrgAccount assumes the role in the Organizations account the user chooses, with
+// the profile's credentials
+func pickOrgAccount(ctx context.Context, src *credentialSource, roleName string) (aws.Credentials, error) {
+	creds, err := src.load(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	accounts, err := listOrgAccounts(ctx, creds, src.region)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	if len(accounts) == 0 {
+		return aws.Credentials{}, fmt.Errorf("no active accounts found in the organization")
+	}
+
+	items := make([]string, len(accounts))
+	for i, account := range accounts {
+		items[i] = fmt.Sprintf("%s  %s  %s", account.Name, account.Id, account.Email)
+	}
+	choice, err := fuzzyPick("Account", items, 0)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	account := accounts[choice].Id
+
+	roleArn := fmt.Sprintf("arn:%s:iam::%s:role/%s", regionPartition(src.region), account, roleName)
+	creds, err = assumeInAccount(ctx, accountRoleClient(creds, src.region), roleArn)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	creds.AccountID = account
+	return creds, nil
+}
+
+// ssoProfile is where the profile's SSO access token is cached, as aws sso login
+// caches it
+type ssoProfile struct {
+	startURL    string
+	region      string
+	sessionName string
+	tokenPath   string
+}
+
+func loadSSOProfile(ctx context.Context) (ssoProfile, error) {
+	shared, err := loadSharedProfile(ctx, profileOrDefault())
+	if err != nil {
+		return ssoProfile{}, err
+	}
+	p := ssoProfile{startURL: shared.SSOStartURL, region: shared.SSORegion}
+	key := p.startURL
+	if s := shared.SSOSession; s != nil {
+		p = ssoProfile{startURL: s.SSOStartURL, region: s.SSORegion, sessionName: s.Name}
+		key = s.Name
+	}
+	if p.startURL == "" {
+		return ssoProfile{}, fmt.Errorf("profile %s has no sso_start_url or sso_session", profileOrDefault())
+	}
+	if p.tokenPath, err = ssocreds.StandardCachedTokenFilepath(key); err != nil {
+		return ssoProfile{}, fmt.Errorf("failed to locate the SSO token cache, %w", err)
+	}
+	return p, nil
+}
+
+// accessToken reads the token aws sso login cached, which this doesn't refresh
+func (p ssoProfile) accessToken() (string, error) {
+	data, err := os.ReadFile(p.tokenPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the SSO token, run aws sso login --profile %s first, %w", profileOrDefault(), err)
+	}
+	var token struct {
+		AccessToken string    `json:"accessToken"`
+		ExpiresAt   time.Time `json:"expiresAt"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", fmt.Errorf("failed to decode the SSO token %s, %w", p.tokenPath, err)
+	}
+	if token.AccessToken == "" || time.Now().After(token.ExpiresAt) {
+		return "", fmt.Errorf("the SSO token has expired, run aws sso login --profile %s", profileOrDefault())
+	}
+	return token.AccessToken, nil
+}
+
+// pickSSORole gets credentials for the account, then role, the user chooses from those
+// the profile's SSO session is assigned
+func pickSSORole(ctx context.Context) (aws.Credentials, error) {
+	p, err := loadSSOProfile(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	token, err := p.accessToken()
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	client := sso.New(sso.Options{Region: p.region, HTTPClient: httpClient()})
+
+	var accounts []types.AccountInfo
+	pages := sso.NewListAccountsPaginator(client, &sso.ListAccountsInput{AccessToken: aws.String(token)})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf("failed to list SSO accounts, %w", err)
+		}
+		accounts = append(accounts, page.AccountList...)
+	}
+	if len(accounts) == 0 {
+		return aws.Credentials{}, fmt.Errorf("the SSO session has no accounts assigned")
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return aws.ToString(accounts[i].AccountName) < aws.ToString(accounts[j].AccountName)
+	})
+	items := make([]string, len(accounts))
+	for i, account := range accounts {
+		items[i] = fmt.Sprintf("%s  %s  %s", aws.ToString(account.AccountName), aws.ToString(account.AccountId), aws.ToString(account.EmailAddress))
+	}
+	choice, err := fuzzyPick("Account", items, 0)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	account := aws.ToString(accounts[choice].AccountId)
+
+	var roles []string
+	rolePages := sso.NewListAccountRolesPaginator(client, &sso.ListAccountRolesInput{
+		AccessToken: aws.String(token),
+		AccountId:   aws.String(account),
+	})
+	for rolePages.HasMorePages() {
+		page, err := rolePages.NextPage(ctx)
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf("failed to list SSO roles of %s, %w", account, err)
+		}
+		for _, role := range page.RoleList {
+			roles = append(roles, aws.ToString(role.RoleName))
+		}
+	}
+	if len(roles) == 0 {
+		return aws.Credentials{}, fmt.Errorf("the SSO session has no roles in %s", account)
+	}
+	sort.Strings(roles)
+	role := roles[0]
+	if len(roles) > 1 {
+		if choice, err = fuzzyPick("Role", roles, 0); err != nil {
+			return aws.Credentials{}, err
+		}
+		role = roles[choice]
+	}
+
+	provider := ssocreds.New(client, account, role, p.startURL, func(o *ssocreds.Options) {
+		o.CachedTokenFilepath = p.tokenPath
+	})
+	if noCache {
+		return provider.Retrieve(ctx)
+	}
+	// The same key the aws CLI caches the role's credentials under
+	return NewCache(provider, forceRefresh, dpapiCache, computableCacheKey{
+		AccountId:   account,
+		RoleName:    role,
+		SessionName: p.sessionName,
+		StartUrl:    p.startURL,
+	}).Load(ctx)
+}
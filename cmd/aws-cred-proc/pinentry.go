@@ -0,0 +1,128 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// pinentryEscaper percent-escapes the characters the Assuan protocol does not allow in a line
+var pinentryEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// pinentry is a minimal Assuan client for a pinentry program, see
+// https://www.gnupg.org/documentation/manuals/assuan/
+type pinentry struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+func startPinentry(program string) (*pinentry, error) {
+	cmd := exec.Command(program)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s, %w", program, err)
+	}
+
+	p := &pinentry{cmd: cmd, in: in, out: bufio.NewReader(out)}
+	// The server greets with an OK line once it is ready
+	if _, err := p.response(); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// response reads lines up to the final OK or ERR, returning the decoded data lines
+func (p *pinentry) response() (string, error) {
+	var data strings.Builder
+	for {
+		line, err := p.out.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("failed to read from pinentry, %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "OK" || strings.HasPrefix(line, "OK "):
+			return data.String(), nil
+		case strings.HasPrefix(line, "ERR "):
+			return "", fmt.Errorf("pinentry error: %s", strings.TrimPrefix(line, "ERR "))
+		case strings.HasPrefix(line, "D "):
+			// Data is percent-escaped the same way as a URL path, minus the '+' handling
+			value, err := url.PathUnescape(strings.TrimPrefix(line, "D "))
+			if err != nil {
+				return "", fmt.Errorf("invalid pinentry data, %w", err)
+			}
+			data.WriteString(value)
+		}
+		// Status (S) and comment (#) lines are ignored
+	}
+}
+
+func (p *pinentry) command(name, arg string) (string, error) {
+	line := name
+	if arg != "" {
+		line += " " + pinentryEscaper.Replace(arg)
+	}
+	if _, err := fmt.Fprintf(p.in, "%s\n", line); err != nil {
+		return "", fmt.Errorf("failed to write to pinentry, %w", err)
+	}
+	return p.response()
+}
+
+func (p *pinentry) Close() error {
+	fmt.Fprintln(p.in, "BYE")
+	p.in.Close()
+	return p.cmd.Wait()
+}
+
+// PinentryCode prompts for the MFA code in the same pinentry dialog gpg-agent uses,
+// which works without a TTY when a graphical pinentry is installed
+func PinentryCode(program string, mfaSerial *string) func() (string, error) {
+	return func() (string, error) {
+		p, err := startPinentry(program)
+		if err != nil {
+			return "", err
+		}
+		defer p.Close()
+
+		desc := "Enter the MFA code"
+		if mfaSerial != nil {
+			desc = fmt.Sprintf("Enter the MFA code for %s", *mfaSerial)
+		}
+		options := [][2]string{
+			{"SETTITLE", "aws-cred-proc"},
+			{"SETDESC", desc},
+			{"SETPROMPT", "MFA Code:"},
+		}
+		// Curses pinentry needs to know which terminal to use
+		if tty := os.Getenv("GPG_TTY"); tty != "" {
+			options = append(options, [2]string{"OPTION", "ttyname=" + tty})
+		}
+		for _, option := range options {
+			if _, err := p.command(option[0], option[1]); err != nil {
+				return "", err
+			}
+		}
+
+		code, err := p.command("GETPIN", "")
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(code), nil
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/ryandeivert/aws-cred-proc/internal/shell"
+)
+
+// nextStage resolves the credentials with the rest of the pipeline
+type nextStage func(ctx context.Context) (aws.Credentials, error)
+
+// stage is one step of the pipeline credentials are resolved through. A stage can act
+// before and after calling next, or return without calling it at all, e.g. on a cache hit
+type stage func(ctx context.Context, src *credentialSource, next nextStage) (aws.Credentials, error)
+
+// stages are the built-in stages a pipeline can be made of. Profiles can define
+// their own with pipeline_command_<name>, see commandStage
+var stages = map[string]stage{
+	"hello":      helloStage,
+	"account-id": accountIDStage,
+	"cache":      cacheStage,
+}
+
+// The stages every pipeline ends with, in this order. The SDK's provider does all three,
+// so only commands can be placed between them, which run as the provider reaches them
+const (
+	sourceStageName = "source" // get the source credentials
+	mfaStageName    = "mfa"    // prompt for MFA
+	assumeStageName = "assume" // assume the role
+)
+
+var retrieveStages = []string{sourceStageName, mfaStageName, assumeStageName}
+
+// retrieveStageName is shorthand for the three, from before they were split
+const retrieveStageName = "retrieve"
+
+// retrieveProgress tracks the commands placed between the retrieve stages while the
+// provider runs
+type retrieveProgress struct {
+	ctx      context.Context
+	commands map[string][]string // by the stage they follow
+	done     map[string]bool
+}
+
+// defaultPipeline is used unless the profile's pipeline setting lists other stages
+var defaultPipeline = []string{"hello", "account-id", "cache"}
+
+// Profile settings that change the pipeline
+const (
+	pipelineSetting       = "pipeline"
+	pipelineCommandPrefix = "pipeline_command_"
+)
+
+// pipeline returns the stage names for the profile, always ending with source, mfa and
+// assume, with only commands between them
+func pipeline() ([]string, error) {
+	names := defaultPipeline
+	if setting := profileSetting(pipelineSetting); setting != "" {
+		names = nil
+		for _, name := range strings.Split(setting, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if i := slices.Index(names, retrieveStageName); i >= 0 {
+		if i != len(names)-1 {
+			return nil, fmt.Errorf("pipeline stage %s must be last", retrieveStageName)
+		}
+		names = append(names[:i:i], retrieveStages...)
+	}
+	if !slices.ContainsFunc(names, func(name string) bool { return slices.Contains(retrieveStages, name) }) {
+		names = append(names[:len(names):len(names)], retrieveStages...)
+	}
+
+	next := 0 // of retrieveStages
+	for _, name := range names {
+		if next < len(retrieveStages) && name == retrieveStages[next] {
+			next++
+			continue
+		}
+		if slices.Contains(retrieveStages, name) {
+			return nil, fmt.Errorf("pipeline stages %s must each be listed once, in that order", strings.Join(retrieveStages, ", "))
+		}
+		if _, ok := stages[name]; ok {
+			if next > 0 {
+				return nil, fmt.Errorf("pipeline stage %s must come before %s, only commands can be placed between %s", name, sourceStageName, strings.Join(retrieveStages, ", "))
+			}
+			continue
+		}
+		if profileSetting(pipelineCommandPrefix+name) == "" {
+			builtin := make([]string, 0, len(stages))
+			for name := range stages {
+				builtin = append(builtin, name)
+			}
+			sort.Strings(builtin)
+			return nil, fmt.Errorf("unknown pipeline stage %q. Define it with %s%s in the profile, or use one of: %s", name, pipelineCommandPrefix, name, strings.Join(builtin, ", "))
+		}
+	}
+	if next != len(retrieveStages) {
+		return nil, fmt.Errorf("pipeline stages %s must each be listed once, in that order", strings.Join(retrieveStages, ", "))
+	}
+	return names, nil
+}
+
+// runPipeline resolves the credentials through the stages in order
+func (src *credentialSource) runPipeline(ctx context.Context, names []string) (aws.Credentials, error) {
+	if len(names) == 0 {
+		return src.provider.Retrieve(ctx)
+	}
+	if names[0] == sourceStageName {
+		return src.retrieve(ctx, names[1:])
+	}
+
+	name, rest := names[0], names[1:]
+	run, ok := stages[name]
+	if !ok {
+		run = commandStage(name)
+	}
+	return run(ctx, src, func(ctx context.Context) (aws.Credentials, error) {
+		return src.runPipeline(ctx, rest)
+	})
+}
+
+// retrieve runs the SDK's provider, running the commands placed after the source and
+// mfa stages as it reaches them, see finishStage
+func (src *credentialSource) retrieve(ctx context.Context, names []string) (aws.Credentials, error) {
+	src.progress = &retrieveProgress{ctx: ctx, commands: map[string][]string{}, done: map[string]bool{}}
+	defer func() { src.progress = nil }()
+	stage := sourceStageName
+	for _, name := range names {
+		if slices.Contains(retrieveStages, name) {
+			stage = name
+			continue
+		}
+		src.progress.commands[stage] = append(src.progress.commands[stage], name)
+	}
+
+	creds, err := src.provider.Retrieve(ctx)
+	if err != nil {
+		return creds, err
+	}
+	// Those the provider didn't reach, e.g. without a role to assume
+	for _, stage := range retrieveStages {
+		if err := src.finishStage(stage); err != nil {
+			return aws.Credentials{}, err
+		}
+	}
+	return creds, nil
+}
+
+// finishStage runs the commands placed after the stage, once. The SDK only gets the
+// source credentials as it calls AssumeRole, after the MFA prompt, so the commands after
+// the source stage get them first
+func (src *credentialSource) finishStage(stage string) error {
+	progress := src.progress
+	if progress == nil || progress.done[stage] {
+		return nil
+	}
+	progress.done[stage] = true
+	commands := progress.commands[stage]
+	if len(commands) == 0 {
+		return nil
+	}
+	if stage == sourceStageName && src.sourceCredentials != nil {
+		if _, err := src.sourceCredentials.Retrieve(progress.ctx); err != nil {
+			return err
+		}
+	}
+	for _, name := range commands {
+		if err := runStageCommand(progress.ctx, src, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helloStage requires Windows Hello verification, with -windows-hello
+func helloStage(ctx context.Context, _ *credentialSource, next nextStage) (aws.Credentials, error) {
+	if windowsHello {
+		if err := helloVerify(profileOrDefault()); err != nil {
+			return aws.Credentials{}, err
+		}
+	}
+	return next(ctx)
+}
+
+// accountIDStage fills in the account of the credentials, see accountID
+func accountIDStage(ctx context.Context, src *credentialSource, next nextStage) (aws.Credentials, error) {
+	creds, err := next(ctx)
+	if err == nil && creds.AccountID == "" {
+		creds.AccountID = src.accountID(ctx, creds)
+	}
+	return creds, err
+}
+
+// cacheStage returns cached credentials, only calling the rest of the pipeline when
+// they need to be refreshed. With -no-cache it does nothing
+func cacheStage(ctx context.Context, src *credentialSource, next nextStage) (aws.Credentials, error) {
+	if noCache {
+		return next(ctx)
+	}
+	cache := NewCache(aws.CredentialsProviderFunc(next), forceRefresh, dpapiCache, src.cacheKey)
+	if debugLog {
+		inputs, _ := json.Marshal(src.cacheKey)
+		debugf("cache key %s from %s", src.cacheKey, inputs)
+	}
+	creds, err := cache.Load(ctx)
+	src.stats.cache = "miss"
+	if cache.hit {
+		src.stats.cache = "hit"
+	}
+	if cache.stale {
+		src.stats.cache = "stale"
+	}
+	debugf("cache %s: %s", src.stats.cache, cache.location())
+	return creds, err
+}
+
+// commandStage runs a profile's pipeline_command_<name> before the rest of the pipeline,
+// e.g. to ask for approval
+func commandStage(name string) stage {
+	return func(ctx context.Context, src *credentialSource, next nextStage) (aws.Credentials, error) {
+		if err := runStageCommand(ctx, src, name); err != nil {
+			return aws.Credentials{}, err
+		}
+		return next(ctx)
+	}
+}
+
+// runStageCommand runs the command of a stage with the shell. It is connected to the
+// terminal, and the pipeline stops if it exits with an error. Its output goes to stderr
+// so it can't corrupt the credentials
+func runStageCommand(ctx context.Context, src *credentialSource, name string) error {
+	cmd := shellCommand(ctx, profileSetting(pipelineCommandPrefix+name))
+	cmd.Env = append(cmd.Environ(),
+		"AWS_CRED_PROC_ROLE_ARN="+src.cacheKey.RoleArn,
+		"AWS_CRED_PROC_PROFILE="+profileOrDefault(),
+	)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pipeline stage %s failed, %w", name, err)
+	}
+	return nil
+}
+
+// shellCommand runs command with sh -c, or cmd /C on Windows, the same as the SDK runs a
+// credential_process, so settings can quote arguments and use pipes
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return shell.Command(ctx, command)
+}
+
+// describeStage explains what the stage does for the current flags, for explain
+func describeStage(name string) string {
+	switch name {
+	case "hello":
+		if !windowsHello {
+			return "inactive without -windows-hello"
+		}
+		return "Windows Hello verification"
+	case "account-id":
+		return "fill in the account ID"
+	case "cache":
+		if noCache {
+			return "inactive with -no-cache"
+		}
+		return "return cached credentials until they need to be refreshed"
+	case sourceStageName:
+		return "get the source credentials"
+	case mfaStageName:
+		return "prompt for MFA, if the profile has an mfa_serial"
+	case assumeStageName:
+		return "assume the role, if the profile has a role_arn"
+	default:
+		return "run " + profileSetting(pipelineCommandPrefix+name)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		want     []string
+		wantErr  string
+	}{
+		{name: "default", want: []string{"hello", "account-id", "cache", "source", "mfa", "assume"}},
+		{name: "reordered", settings: "pipeline = cache, hello", want: []string{"cache", "hello", "source", "mfa", "assume"}},
+		{name: "retrieve shorthand", settings: "pipeline = cache,retrieve", want: []string{"cache", "source", "mfa", "assume"}},
+		{
+			name:     "commands between the retrieve stages",
+			settings: "pipeline = approve,source,mfa,notify,assume\npipeline_command_approve = true\npipeline_command_notify = true",
+			want:     []string{"approve", "source", "mfa", "notify", "assume"},
+		},
+		{name: "retrieve not last", settings: "pipeline = retrieve,cache", wantErr: "must be last"},
+		{name: "retrieve stages out of order", settings: "pipeline = cache,mfa,source,assume", wantErr: "in that order"},
+		{name: "retrieve stages missing one", settings: "pipeline = source,assume", wantErr: "in that order"},
+		{name: "built-in stage after source", settings: "pipeline = source,cache,mfa,assume", wantErr: "must come before source"},
+		{name: "undefined command", settings: "pipeline = approve", wantErr: `unknown pipeline stage "approve"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, "test", "[profile test]\n"+tt.settings+"\n")
+			got, err := pipeline()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("pipeline() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pipeline() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The commands run in the order they're listed in, relative to the provider, including
+// those the provider didn't reach because there was no role to assume
+func TestRunPipelineOrder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands append to the log with sh")
+	}
+	log := filepath.Join(t.TempDir(), "log")
+	t.Setenv("PIPELINE_LOG", log)
+	useConfig(t, "test", `[profile test]
+pipeline = before,source,after-source,mfa,after-mfa,assume,after-assume
+pipeline_command_before = echo before >> "$PIPELINE_LOG"
+pipeline_command_after-source = echo after-source >> "$PIPELINE_LOG"
+pipeline_command_after-mfa = echo after-mfa >> "$PIPELINE_LOG"
+pipeline_command_after-assume = echo after-assume >> "$PIPELINE_LOG"
+`)
+	names, err := pipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := &credentialSource{
+		provider: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			f, err := os.OpenFile(log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				return aws.Credentials{}, err
+			}
+			defer f.Close()
+			_, err = f.WriteString("provider\n")
+			return aws.Credentials{AccessKeyID: "AKIA"}, err
+		}),
+	}
+	if _, err := src.runPipeline(context.Background(), names); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"before", "provider", "after-source", "after-mfa", "after-assume"}
+	if got := strings.Fields(string(data)); !slices.Equal(got, want) {
+		t.Errorf("ran %v, want %v", got, want)
+	}
+}
+
+// A failing command stops the pipeline before the credentials are retrieved
+func TestRunPipelineCommandFails(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command exits with sh")
+	}
+	useConfig(t, "test", "[profile test]\npipeline = deny,cache\npipeline_command_deny = exit 1\n")
+	names, err := pipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &countingProvider{}
+	src := &credentialSource{provider: provider}
+	if _, err := src.runPipeline(context.Background(), names); err == nil || !strings.Contains(err.Error(), "pipeline stage deny failed") {
+		t.Errorf("runPipeline() error = %v, want the deny stage to fail", err)
+	}
+	if provider.calls != 0 {
+		t.Errorf("retrieved %d times after the pipeline stopped", provider.calls)
+	}
+}
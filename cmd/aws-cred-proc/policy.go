@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// readSessionPolicy reads a policy document for -session-policy. It is compacted so
+// formatting changes to the file do not change the cache key
+func readSessionPolicy(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read session policy, %w", err)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid session policy json in %s, %w", path, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// protectMemory disables core dumps and marks the process non-dumpable, which
+// also prevents other processes of the same user from attaching with ptrace or
+// reading /proc/<pid>/mem, so credentials held in memory can't be snapshotted
+func protectMemory() error {
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{}); err != nil {
+		return fmt.Errorf("failed to disable core dumps, %w", err)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_DUMPABLE, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to mark process non-dumpable, %w", errno)
+	}
+	return nil
+}
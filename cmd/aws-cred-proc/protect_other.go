@@ -0,0 +1,16 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// protectMemory disables core dumps so credentials held in memory are never written to disk
+func protectMemory() error {
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{}); err != nil {
+		return fmt.Errorf("failed to disable core dumps, %w", err)
+	}
+	return nil
+}
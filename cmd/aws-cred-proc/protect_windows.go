@@ -0,0 +1,7 @@
+package main
+
+// protectMemory is a no-op on Windows, where crash dumps are governed by
+// Windows Error Reporting policy rather than per-process limits
+func protectMemory() error {
+	return nil
+}
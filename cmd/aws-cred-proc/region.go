@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+)
+
+// regionFromIMDS has the region fall back on the EC2 instance's placement, set with
+// -region-from-imds. Off EC2 the probe takes up to a second on every call, so it's opt-in
+var regionFromIMDS bool
+
+// defaultRegion is used when the region can't be resolved from anywhere else
+const defaultRegion = "us-east-1"
+
+// regionMapPath is a file of "<account id> = <region>" lines used to pick the
+// region for profiles that don't set one
+func regionMapPath() string {
+	return filepath.Join(stateDir(), "regions")
+}
+
+// resolveRegion returns the region credentials should be resolved for, along with
+// a description of where it came from. In order, the region is taken from:
+//   - the -region flag
+//   - AWS_REGION or AWS_DEFAULT_REGION, the same as the SDK
+//   - the profile's region, the same as the SDK
+//   - the region map entry for the account of the profile's role_arn or sso_account_id
+//   - the profile's sso_region, or that of its sso-session
+//   - with -region-from-imds, the placement of the EC2 instance this is running on
+//   - us-east-1, or the default region of the role's partition for roles in others
+func resolveRegion(ctx context.Context) (string, string) {
+	if awsRegion != "" {
+		return awsRegion, "-region flag"
+	}
+	for _, key := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if v := os.Getenv(key); v != "" {
+			return v, "environment variable " + key
+		}
+	}
+
+	shared, err := loadSharedProfile(ctx, profileOrDefault())
+	var notExist config.SharedConfigProfileNotExistError
+	if err != nil && !errors.As(err, &notExist) {
+		// Leave it to the SDK to report invalid config
+		return defaultRegion, "default"
+	}
+
+	if shared.Region != "" {
+		return shared.Region, "region of profile " + shared.Profile
+	}
+
+	account, partition := shared.SSOAccountID, ""
+	if parsed, err := arn.Parse(shared.RoleARN); err == nil {
+		account, partition = parsed.AccountID, parsed.Partition
+	}
+	if account != "" {
+		// An entry for a region in another partition than the role's can't be right
+		region := regionForAccount(account)
+		if region != "" && (partition == "" || regionPartition(region) == partition) {
+			return region, "account " + account + " in " + regionMapPath()
+		}
+	}
+
+	if shared.SSORegion != "" {
+		return shared.SSORegion, "sso_region of profile " + shared.Profile
+	}
+	if shared.SSOSession != nil && shared.SSOSession.SSORegion != "" {
+		return shared.SSOSession.SSORegion, "sso_region of sso-session " + shared.SSOSession.Name
+	}
+
+	if regionFromIMDS && !imdsDisabled() {
+		if region, err := imdsRegion(ctx); err == nil && region != "" {
+			return region, "EC2 instance metadata placement"
+		}
+	}
+
+	if region, ok := partitionDefaultRegions[partition]; ok && partition != partitionAWS {
+		return region, "default of partition " + partition
+	}
+	return defaultRegion, "default"
+}
+
+// regionForAccount looks up the account in the region map, returning an empty
+// string if there is no map or no entry for the account
+func regionForAccount(account string) string {
+	f, err := loadINI(regionMapPath())
+	if err != nil {
+		return ""
+	}
+	for _, line := range f.lines {
+		if key, value, ok := parseKeyValue(line); ok && key == account {
+			return value
+		}
+	}
+	return ""
+}
+
+// imdsRegion returns the region of the EC2 instance's placement. A short timeout
+// and no retries keep this from stalling when not running on EC2
+func imdsRegion(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	client := imds.New(imds.Options{Retryer: aws.NopRetryer{}})
+	out, err := client.GetRegion(ctx, &imds.GetRegionInput{})
+	if err != nil {
+		return "", err
+	}
+	return out.Region, nil
+}
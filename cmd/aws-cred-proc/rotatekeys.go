@@ -0,0 +1,260 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "rotate-keys",
+		usage: "rotate the access key of the IAM user the profile's source credentials belong to: create a new key, check that it works, write it to the shared credentials file and delete the old key",
+		run:   runRotateKeys,
+	})
+}
+
+const (
+	iamAPIVersion       = "2010-05-08"
+	iamCallTimeout      = 30 * time.Second
+	rotateVerifyTimeout = time.Minute
+	rotateVerifyDelay   = 5 * time.Second
+)
+
+// iamEndpoint returns the global IAM endpoint of the region's partition, and the
+// region requests to it are signed for
+func iamEndpoint(region string) (string, string) {
+	switch regionPartition(region) {
+	case partitionAWSUSGov:
+		return "https://iam.us-gov.amazonaws.com/", "us-gov-west-1"
+	case partitionAWSCN:
+		return "https://iam.cn-north-1.amazonaws.com.cn/", "cn-north-1"
+	default:
+		return "https://iam.amazonaws.com/", "us-east-1"
+	}
+}
+
+// iamCall calls an IAM action over the query protocol and decodes the XML response into
+// out. The handful of calls made here don't warrant pulling the whole IAM client into the binary
+func iamCall(ctx context.Context, creds aws.Credentials, region, action string, params url.Values, out any) error {
+	endpoint, signingRegion := iamEndpoint(region)
+	params.Set("Action", action)
+	params.Set("Version", iamAPIVersion)
+	body := params.Encode()
+
+	ctx, cancel := context.WithTimeout(ctx, iamCallTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	sum := sha256.Sum256([]byte(body))
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "iam", signingRegion, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign %s request, %w", action, err)
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s, %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response, %w", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Code    string
+				Message string
+			}
+		}
+		if xml.Unmarshal(data, &failure) == nil && failure.Error.Code != "" {
+			return fmt.Errorf("%s failed, %s: %s", action, failure.Error.Code, failure.Error.Message)
+		}
+		return fmt.Errorf("%s failed, IAM returned %s", action, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := xml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode %s response, %w", action, err)
+	}
+	return nil
+}
+
+// rotateKeysProfile follows source_profile from the profile to the one whose long-term
+// keys are kept in the shared credentials file, the same way the SDK resolves it
+func rotateKeysProfile(ctx context.Context) (string, aws.Credentials, error) {
+	if systemdCreds || profileSetting(passCredentialsSetting) != "" {
+		return "", aws.Credentials{}, fmt.Errorf("rotate-keys only rotates keys kept in the shared credentials file")
+	}
+
+	file, err := loadINI(sharedCredentialsPath())
+	if err != nil {
+		return "", aws.Credentials{}, err
+	}
+
+	name := profileOrDefault()
+	seen := map[string]bool{}
+	for !seen[name] {
+		seen[name] = true
+		shared, err := loadSharedProfile(ctx, name)
+		if err != nil {
+			return "", aws.Credentials{}, fmt.Errorf("failed to load profile %q, %w", name, err)
+		}
+		if shared.RoleARN != "" && shared.SourceProfileName != "" && shared.SourceProfileName != name {
+			name = shared.SourceProfileName
+			continue
+		}
+
+		values := file.values(name)
+		if values["aws_access_key_id"] == "" || values["aws_secret_access_key"] == "" {
+			return "", aws.Credentials{}, fmt.Errorf("profile %q has no access key in %s to rotate", name, sharedCredentialsPath())
+		}
+		if values["aws_session_token"] != "" {
+			return "", aws.Credentials{}, fmt.Errorf("profile %q holds temporary credentials, which can't be rotated", name)
+		}
+		return name, aws.Credentials{
+			AccessKeyID:     values["aws_access_key_id"],
+			SecretAccessKey: values["aws_secret_access_key"],
+		}, nil
+	}
+	return "", aws.Credentials{}, fmt.Errorf("profile %q has a source_profile loop", name)
+}
+
+// verifyAccessKey calls GetCallerIdentity with the key until it works. New keys can take
+// a few seconds to be accepted everywhere
+func verifyAccessKey(ctx context.Context, creds aws.Credentials, region string) error {
+	client := sts.New(sts.Options{
+		Credentials: credentials.StaticCredentialsProvider{Value: creds},
+		Region:      region,
+	}, withSTSOptions)
+	deadline := time.Now().Add(rotateVerifyTimeout)
+	for {
+		_, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("failed to verify the new access key, %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to verify the new access key, %w", err)
+		case <-time.After(rotateVerifyDelay):
+		}
+	}
+}
+
+// deleteNewAccessKey deletes the key a failed rotation created. ctx being cancelled is one
+// of the ways it fails, so the call only keeps ctx's values and gets its own timeout
+func deleteNewAccessKey(ctx context.Context, creds aws.Credentials, region, accessKeyID string) error {
+	params := url.Values{"AccessKeyId": {accessKeyID}}
+	return iamCall(context.WithoutCancel(ctx), creds, region, "DeleteAccessKey", params, nil)
+}
+
+func runRotateKeys(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageProfile = "the aws config profile whose source credentials to rotate. The source_profile chain is followed to the profile with the keys"
+	)
+
+	fs.StringVar(&profile, "profile", "", usageProfile)
+	fs.StringVar(&profile, "p", "", shorthandPrefix+"-profile")
+	fs.Parse(args)
+
+	section, old, err := rotateKeysProfile(ctx)
+	if err != nil {
+		return err
+	}
+	if err := loadCABundle(ctx); err != nil {
+		return err
+	}
+	region, _ := resolveRegion(ctx)
+	_, signingRegion := iamEndpoint(region)
+	if region == "" {
+		region = signingRegion
+	}
+
+	// A user can only have two keys, so there must be room for the new one
+	var list struct {
+		Keys []struct {
+			AccessKeyID string `xml:"AccessKeyId"`
+		} `xml:"ListAccessKeysResult>AccessKeyMetadata>member"`
+	}
+	if err := iamCall(ctx, old, region, "ListAccessKeys", url.Values{}, &list); err != nil {
+		return err
+	}
+	for _, key := range list.Keys {
+		if key.AccessKeyID != old.AccessKeyID {
+			return fmt.Errorf("the user already has a second access key %s. Delete it before rotating", key.AccessKeyID)
+		}
+	}
+
+	var created struct {
+		Key struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string
+		} `xml:"CreateAccessKeyResult>AccessKey"`
+	}
+	if err := iamCall(ctx, old, region, "CreateAccessKey", url.Values{}, &created); err != nil {
+		return err
+	}
+	next := aws.Credentials{
+		AccessKeyID:     created.Key.AccessKeyID,
+		SecretAccessKey: created.Key.SecretAccessKey,
+	}
+
+	// Until the new key is written out, the old one is still the only one anything uses,
+	// so a failure here deletes the new key again
+	undo := func(cause error) error {
+		if err := deleteNewAccessKey(ctx, old, region, next.AccessKeyID); err != nil {
+			return fmt.Errorf("%w. The new access key %s could not be deleted either, %v", cause, next.AccessKeyID, err)
+		}
+		return cause
+	}
+	if err := verifyAccessKey(ctx, next, region); err != nil {
+		return undo(err)
+	}
+
+	path := sharedCredentialsPath()
+	file, err := loadINI(path)
+	if err != nil {
+		return undo(err)
+	}
+	file.set(section, "aws_access_key_id", next.AccessKeyID)
+	file.set(section, "aws_secret_access_key", next.SecretAccessKey)
+	if err := writeFileAtomic(path, file.bytes()); err != nil {
+		return undo(fmt.Errorf("failed to write %s, %w", path, err))
+	}
+	fmt.Fprintf(os.Stderr, "Wrote the new access key %s to the [%s] section of %s\n", next.AccessKeyID, section, path)
+
+	if err := audit(auditEvent{Action: "rotate-keys", Profile: section}); err != nil {
+		return err
+	}
+
+	params := url.Values{"AccessKeyId": {old.AccessKeyID}}
+	if err := iamCall(ctx, next, region, "DeleteAccessKey", params, nil); err != nil {
+		return fmt.Errorf("the old access key %s is still active and should be deleted, %w", old.AccessKeyID, err)
+	}
+	fmt.Fprintf(os.Stderr, "Deleted the old access key %s\n", old.AccessKeyID)
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// useHTTPClient sends the calls made with httpClient to f for the rest of the test
+func useHTTPClient(t *testing.T, f roundTripperFunc) {
+	t.Helper()
+	prev := caBundleClient
+	caBundleClient = &http.Client{Transport: f}
+	t.Cleanup(func() { caBundleClient = prev })
+}
+
+func TestDeleteNewAccessKeyAfterCancel(t *testing.T) {
+	var deleted []string
+	useHTTPClient(t, func(req *http.Request) (*http.Response, error) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		body, _ := io.ReadAll(req.Body)
+		params, _ := url.ParseQuery(string(body))
+		if params.Get("Action") == "DeleteAccessKey" {
+			deleted = append(deleted, params.Get("AccessKeyId"))
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("<DeleteAccessKeyResponse/>"))}, nil
+	})
+
+	// As when the verification is interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	creds := aws.Credentials{AccessKeyID: "AKIAOLD", SecretAccessKey: "secret"}
+	if err := deleteNewAccessKey(ctx, creds, "us-east-1", "AKIANEW"); err != nil {
+		t.Fatalf("deleteNewAccessKey with a cancelled context failed, %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != "AKIANEW" {
+		t.Errorf("deleted %v, want [AKIANEW]", deleted)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxRoleSessionNameLength = 64
+	minRoleSessionNameLength = 2
+)
+
+// Characters outside of the set STS allows in a RoleSessionName
+var invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]+`)
+
+// roleSessionName expands the {username}, {hostname}, {tool} and {profile}
+// placeholders in template and sanitizes the result so STS will accept it
+func roleSessionName(template string) string {
+	vars := map[string]func() string{
+		"{username}": currentUsername,
+		"{hostname}": shortHostname,
+		"{tool}":     parentProcessName,
+		"{profile}":  profileOrDefault,
+	}
+
+	name := template
+	for placeholder, value := range vars {
+		if strings.Contains(name, placeholder) {
+			name = strings.ReplaceAll(name, placeholder, value())
+		}
+	}
+	return sanitizeRoleSessionName(name)
+}
+
+func sanitizeRoleSessionName(name string) string {
+	name = invalidSessionNameChars.ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-")
+	if len(name) > maxRoleSessionNameLength {
+		name = strings.TrimRight(name[:maxRoleSessionNameLength], "-")
+	}
+	if len(name) < minRoleSessionNameLength {
+		return "aws-cred-proc"
+	}
+	return name
+}
+
+func currentUsername() string {
+	usr, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	// Windows usernames are qualified with the domain, e.g. DOMAIN\user
+	if _, name, ok := strings.Cut(usr.Username, `\`); ok {
+		return name
+	}
+	return usr.Username
+}
+
+func shortHostname() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	host, _, _ = strings.Cut(host, ".")
+	return host
+}
+
+// parentProcessName returns the name of the program that invoked this one,
+// e.g. "aws" or "terraform", falling back on the name of this binary
+func parentProcessName() string {
+	ppid := strconv.Itoa(os.Getppid())
+	if data, err := os.ReadFile(filepath.Join("/proc", ppid, "comm")); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	if out, err := exec.Command("ps", "-o", "comm=", "-p", ppid).Output(); err == nil {
+		if name := strings.TrimSpace(string(out)); name != "" {
+			return filepath.Base(name)
+		}
+	}
+	return filepath.Base(os.Args[0])
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// credentialFlags is the flag set the credential flags were last added to, whose
+// unset flags are filled in from the settings before credentials are resolved
+var credentialFlags *flag.FlagSet
+
+// toolConfigPath is the tool's own config file, in the same format as the aws config file.
+// Settings before the first section apply to every profile, and a [profile name] section
+// overrides them for that profile
+func toolConfigPath() string {
+	if v := os.Getenv("AWS_CRED_PROC_CONFIG_FILE"); v != "" {
+		return v
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "aws-cred-proc", "config")
+}
+
+// Prefix of the settings in a profile of the aws config file that set flags of this tool
+const profileFlagPrefix = "credproc_"
+
+// mfaProviders maps the values of the mfa-provider setting to the flag it turns on
+var mfaProviders = map[string]string{
+	"yubikey":  "mfa-yk",
+	"totp":     "mfa-totp",
+	"pinentry": "mfa-pinentry",
+}
+
+// flagSetting is the value of a flag from a setting, and the file it was read from
+type flagSetting struct {
+	value  string
+	source string
+}
+
+// flagSettings returns the settings that apply to the profile, by flag name. The
+// profile's credproc_ settings in the aws config file take precedence over the tool
+// config file. In both, mfa-provider is shorthand for the flag of the MFA provider
+func flagSettings(profile string) (map[string]flagSetting, error) {
+	settings := map[string]flagSetting{}
+	add := func(values map[string]string, source string, name func(string) (string, bool)) error {
+		for key, value := range values {
+			flagName, ok := name(key)
+			if !ok {
+				continue
+			}
+			if flagName == "mfa-provider" {
+				if flagName, ok = mfaProviders[value]; !ok {
+					return fmt.Errorf("invalid mfa-provider %q in %s, expected one of: yubikey, totp, pinentry", value, source)
+				}
+				value = "true"
+			}
+			settings[flagName] = flagSetting{value, source}
+		}
+		return nil
+	}
+
+	if path := toolConfigPath(); path != "" {
+		file, err := loadINI(path)
+		if err != nil {
+			return nil, err
+		}
+		asIs := func(key string) (string, bool) { return key, true }
+		if err := add(file.globalValues(), path, asIs); err != nil {
+			return nil, err
+		}
+		if err := add(file.values(configSectionName(profile)), path, asIs); err != nil {
+			return nil, err
+		}
+	}
+
+	path := sharedConfigPath()
+	file, err := loadINI(path)
+	if err != nil {
+		return nil, err
+	}
+	prefixed := func(key string) (string, bool) {
+		name, ok := strings.CutPrefix(key, profileFlagPrefix)
+		return strings.ReplaceAll(name, "_", "-"), ok
+	}
+	if err := add(file.values(configSectionName(profile)), path, prefixed); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// flagEnvName is the environment variable that sets the flag, e.g. AWS_CRED_PROC_NO_CACHE
+func flagEnvName(name string) string {
+	return "AWS_CRED_PROC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyFlagDefaults sets each flag that was not given on the command line from its
+// environment variable, or else its setting (see flagSettings), so credential_process
+// lines don't need long flag strings. Shorthands count as the flag they stand for, and
+// the profile can't come from a setting since it selects the settings
+func applyFlagDefaults(fs *flag.FlagSet) error {
+	if fs == nil {
+		return nil
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+		if long, ok := strings.CutPrefix(f.Usage, shorthandPrefix+"-"); ok {
+			given[long] = true
+		}
+	})
+
+	settings, err := flagSettings(profileOrDefault())
+	if err != nil {
+		return err
+	}
+
+	var setErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if setErr != nil || given[f.Name] || f.Name == "profile" || strings.HasPrefix(f.Usage, shorthandPrefix) || strings.HasPrefix(f.Usage, deprecatedPrefix) {
+			return
+		}
+		setting, ok := settings[f.Name]
+		if v, set := os.LookupEnv(flagEnvName(f.Name)); set {
+			setting, ok = flagSetting{v, "environment variable " + flagEnvName(f.Name)}, true
+		}
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, setting.value); err != nil {
+			setErr = fmt.Errorf("invalid %s setting %q from %s, %w", f.Name, setting.value, setting.source, err)
+		}
+	})
+	return setErr
+}
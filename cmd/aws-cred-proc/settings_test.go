@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useToolConfig points the tool config file at one with content, for the rest of the test
+func useToolConfig(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tool-config")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CRED_PROC_CONFIG_FILE", path)
+}
+
+// settingsFlags are a few flags of each kind, defined the way addCredentialFlags does
+type settingsFlags struct {
+	fs                  *flag.FlagSet
+	profile, region     string
+	endpoint, output    string
+	duration            time.Duration
+	noCache, totp, fips bool
+}
+
+func newSettingsFlags() *settingsFlags {
+	f := &settingsFlags{fs: flag.NewFlagSet("test", flag.ContinueOnError)}
+	f.fs.StringVar(&f.profile, "profile", "", "")
+	f.fs.StringVar(&f.region, "region", "", "")
+	f.fs.StringVar(&f.endpoint, "sts-endpoint", "", "")
+	f.fs.StringVar(&f.output, "output", "json", "")
+	f.fs.StringVar(&f.output, "o", "json", shorthandPrefix+"-output")
+	f.fs.DurationVar(&f.duration, "duration", 0, "")
+	f.fs.BoolVar(&f.noCache, "no-cache", false, "")
+	f.fs.BoolVar(&f.totp, "mfa-totp", false, "")
+	f.fs.BoolVar(&f.fips, "fips-endpoint", false, "")
+	return f
+}
+
+// The command line wins over the environment, then the profile's credproc_ settings, then
+// the tool config's profile section, then its global settings
+func TestApplyFlagDefaultsPrecedence(t *testing.T) {
+	useToolConfig(t, `profile = other
+duration = 1h
+region = us-west-2
+fips-endpoint = true
+
+[profile test]
+duration = 2h
+sts-endpoint = https://tool.example
+output = env
+`)
+	useConfig(t, "test", `[profile test]
+credproc_sts_endpoint = https://profile.example
+credproc_mfa_provider = totp
+`)
+	t.Setenv("AWS_CRED_PROC_REGION", "eu-west-1")
+	t.Setenv("AWS_CRED_PROC_NO_CACHE", "true")
+
+	f := newSettingsFlags()
+	if err := f.fs.Parse([]string{"-o", "ini", "-no-cache=false"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyFlagDefaults(f.fs); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		flag      string
+		got, want any
+	}{
+		{"profile, which selects the settings", f.profile, ""},
+		{"duration from the tool config's profile section", f.duration, 2 * time.Hour},
+		{"fips-endpoint from the tool config", f.fips, true},
+		{"region from the environment", f.region, "eu-west-1"},
+		{"sts-endpoint from the profile", f.endpoint, "https://profile.example"},
+		{"mfa-totp from the profile's mfa_provider", f.totp, true},
+		{"output from its shorthand", f.output, "ini"},
+		{"no-cache from the command line", f.noCache, false},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.flag, c.got, c.want)
+		}
+	}
+}
+
+func TestApplyFlagDefaultsInvalid(t *testing.T) {
+	tests := []struct {
+		name, tool, profile string
+		wantErr             string
+	}{
+		{name: "mfa provider", profile: "credproc_mfa_provider = sms", wantErr: `invalid mfa-provider "sms"`},
+		{name: "value", tool: "duration = soon", wantErr: `invalid duration setting "soon" from`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useToolConfig(t, tt.tool)
+			useConfig(t, "test", "[profile test]\n"+tt.profile+"\n")
+			f := newSettingsFlags()
+			if err := applyFlagDefaults(f.fs); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("applyFlagDefaults() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
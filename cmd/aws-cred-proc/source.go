@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// sourceCredentialsOverride returns the source credentials selected by the credential
+// flags that come from outside of the shared config files, or nil if there are none
+func sourceCredentialsOverride() (aws.CredentialsProvider, error) {
+	if systemdCreds {
+		return systemdSourceCredentials()
+	}
+	if entry := profileSetting(passCredentialsSetting); entry != "" {
+		return passSourceCredentials(entry)
+	}
+	return nil, nil
+}
+
+// assumeRoleFromSource replaces cfg.Credentials, which hold source credentials, with a
+// provider that uses them to assume the profile's role. The role options are read from
+// the profile the same way the SDK would, before optFn is applied. If the profile does not
+// exist or has no role_arn, the source credentials are used as they are
+func assumeRoleFromSource(ctx context.Context, cfg *aws.Config, optFn func(*stscreds.AssumeRoleOptions)) error {
+	shared, err := loadSharedProfile(ctx, profileOrDefault())
+	var notExist config.SharedConfigProfileNotExistError
+	if errors.As(err, &notExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if shared.RoleARN == "" {
+		return nil
+	}
+
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(*cfg), shared.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		if shared.ExternalID != "" {
+			o.ExternalID = aws.String(shared.ExternalID)
+		}
+		if shared.MFASerial != "" {
+			o.SerialNumber = aws.String(shared.MFASerial)
+		}
+		if shared.RoleDurationSeconds != nil {
+			o.Duration = *shared.RoleDurationSeconds
+		}
+		o.RoleSessionName = shared.RoleSessionName
+		optFn(o)
+	})
+
+	cfg.Credentials = aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = expiryWindow
+	})
+	return nil
+}
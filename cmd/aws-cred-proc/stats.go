@@ -0,0 +1,71 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "stats",
+		usage: "show how often sessions are minted and read from the cache for each profile, flagging profiles whose sessions keep expiring unused",
+		run:   runStats,
+	})
+}
+
+func runStats(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+
+	stats, err := loadUsage()
+	if err != nil {
+		return err
+	}
+	if len(stats) == 0 {
+		fmt.Println("No usage has been recorded yet. It's only recorded with -usage-stats, e.g. set in the configuration file")
+		return nil
+	}
+
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return stats[keys[i]].Profile < stats[keys[j]].Profile
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tMINTED\tUNUSED\tLAST MINTED\tLAST READ")
+	var wasted []*usageEntry
+	for _, key := range keys {
+		entry := stats[key]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", entry.Profile, entry.Minted, entry.Unused,
+			formatUsageTime(entry.LastMinted), formatUsageTime(entry.LastRead))
+		if _, ok := entry.wasted(); ok {
+			wasted = append(wasted, entry)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, entry := range wasted {
+		streak, _ := entry.wasted()
+		fmt.Printf("\nWarning: the last %d sessions for %q were never read from the cache after they were minted.\n", streak, entry.Profile)
+		fmt.Println("If the profile is no longer needed, consider removing it from your config to avoid needless MFA prompts")
+	}
+	return nil
+}
+
+func formatUsageTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format(time.DateTime)
+}
@@ -0,0 +1,87 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "status",
+		usage: "print how long the profile's cached session remains valid, for shell prompts (starship, tmux, PS1). Only reads the cache, so it's fast and never prompts. Exits with status 1 if nothing is cached and 3 if the session expired",
+		run:   runStatus,
+	})
+}
+
+// statusData is what the status -template is executed with
+type statusData struct {
+	Profile   string
+	Remaining string // compact, e.g. 1h05m, 42m or 30s
+	Seconds   int
+	Expires   time.Time
+}
+
+// compactDuration formats d for a prompt, to the minute unless it's less than one
+func compactDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+func runStatus(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageTemplate = "the Go `template` to print, with the .Profile, .Remaining (e.g. 42m), .Seconds and .Expires fields"
+	)
+	var text string
+
+	addCredentialFlags(fs)
+	fs.StringVar(&text, "template", "{{.Remaining}}\n", usageTemplate)
+	fs.Parse(args)
+
+	tmpl, err := template.New("status").Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse -template, %w", err)
+	}
+
+	// Nothing is retrieved, but the cache key still depends on the profile and flags
+	cacheOnly = true
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+	// Read the entry directly, so a prompt redrawing doesn't count as using the session
+	creds, err := src.cache().get()
+	if errors.Is(err, os.ErrNotExist) {
+		return &exitCodeError{1}
+	}
+	if err != nil {
+		return err
+	}
+	remaining := time.Until(creds.Expires)
+	if remaining <= 0 {
+		return &exitCodeError{exitCodeExpired}
+	}
+
+	data := statusData{
+		Profile:   profileOrDefault(),
+		Remaining: compactDuration(remaining),
+		Seconds:   int(remaining.Seconds()),
+		Expires:   creds.Expires,
+	}
+	if err := tmpl.Execute(os.Stdout, data); err != nil {
+		return fmt.Errorf("failed to execute -template, %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// assumeRoleClient wraps the STS client the SDK assumes roles with, so each AssumeRole
+// request can be adjusted with things that are only known when it is actually made
+type assumeRoleClient struct {
+	stscreds.AssumeRoleAPIClient
+
+	// omitDuration leaves DurationSeconds unset, which the SDK's provider otherwise
+	// always sends (defaulting to 15 minutes), so the default of STS applies
+	omitDuration bool
+
+	// beforeCall runs ahead of each call, for the pipeline's stages
+	beforeCall func() error
+}
+
+func (c *assumeRoleClient) AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	if c.beforeCall != nil {
+		if err := c.beforeCall(); err != nil {
+			return nil, err
+		}
+	}
+	if attestationCmd != "" {
+		if err := attest(ctx, params); err != nil {
+			return nil, err
+		}
+	}
+	if c.omitDuration {
+		params.DurationSeconds = nil
+	}
+	optFns = append(optFns[:len(optFns):len(optFns)], stsCallOptions()...)
+
+	start := time.Now()
+	out, err := c.AssumeRoleAPIClient.AssumeRole(ctx, params, optFns...)
+	debugf("AssumeRole %s took %s", aws.ToString(params.RoleArn), time.Since(start).Round(time.Millisecond))
+	for _, region := range failoverRegions() {
+		if err == nil || ctx.Err() != nil || !stsUnavailable(err) {
+			break
+		}
+		if client, ok := c.AssumeRoleAPIClient.(*sts.Client); ok && client.Options().Region == region {
+			continue // already tried
+		}
+		log.Printf("warning: STS is unavailable, failing over to %s: %v", region, err)
+		regionFns := append(optFns[:len(optFns):len(optFns)], func(o *sts.Options) {
+			o.Region = region
+		})
+		start = time.Now()
+		out, err = c.AssumeRoleAPIClient.AssumeRole(ctx, params, regionFns...)
+		debugf("AssumeRole %s in %s took %s", aws.ToString(params.RoleArn), region, time.Since(start).Round(time.Millisecond))
+	}
+	return out, err
+}
+
+// stsCallOptions point a call of an STS client created from the loaded config at the
+// endpoint selected by -sts-endpoint or -sts-global-endpoint
+func stsCallOptions() []func(*sts.Options) {
+	var optFns []func(*sts.Options)
+	if stsEndpoint != "" {
+		optFns = append(optFns, withSTSOptions)
+	}
+	if stsGlobalEndpoint {
+		optFns = append(optFns, func(o *sts.Options) {
+			o.Region = stsGlobalRegion(o.Region)
+		})
+	}
+	return optFns
+}
+
+// validateSTSEndpoint checks the -sts-endpoint URL, which can't be combined with the
+// global endpoint
+func validateSTSEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid -sts-endpoint %q, expected an http(s) URL", endpoint)
+	}
+	if stsGlobalEndpoint {
+		return fmt.Errorf("-sts-endpoint and -sts-global-endpoint can't be used together")
+	}
+	return nil
+}
+
+// withSTSOptions points an STS client that is not created from the loaded config at
+// the endpoint selected by -sts-endpoint, -fips-endpoint and -dualstack-endpoint, and
+// has it trust the CA bundle and retry the way the retry flags say
+func withSTSOptions(o *sts.Options) {
+	if caBundleClient != nil {
+		o.HTTPClient = caBundleClient
+	}
+	if retryMaxAttempts > 0 || retryMaxBackoff > 0 {
+		o.Retryer = newRetryer()
+	}
+	if stsEndpoint != "" {
+		o.BaseEndpoint = aws.String(stsEndpoint)
+	}
+	if useFIPSEndpoint {
+		o.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateEnabled
+	}
+	if useDualStackEndpoint {
+		o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+	}
+}
+
+// newRetryer returns the SDK's standard retryer, which backs off exponentially with full
+// jitter on throttling and transient errors, with the limits set by the retry flags
+func newRetryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		if retryMaxAttempts > 0 {
+			o.MaxAttempts = retryMaxAttempts
+		}
+		if retryMaxBackoff > 0 {
+			o.MaxBackoff = retryMaxBackoff
+		}
+	})
+}
+
+// stsGlobalRegion returns the pseudo region the SDK resolves to the global STS endpoint,
+// or an empty string if the region's partition has none
+func stsGlobalRegion(region string) string {
+	if regionPartition(region) != partitionAWS {
+		return ""
+	}
+	return "aws-global"
+}
+
+// failoverRegions returns the regions from -sts-failover-regions, or the profile's
+// sts_failover_regions setting
+func failoverRegions() []string {
+	// The regions would all be sent to the same custom endpoint
+	if stsEndpoint != "" {
+		return nil
+	}
+
+	value := stsFailoverRegions
+	if value == "" {
+		value = profileSetting("sts_failover_regions")
+	}
+
+	var regions []string
+	for _, region := range strings.Split(value, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// stsUnreachable reports whether the error means STS couldn't be reached or throttled the
+// request, as opposed to rejecting it, so the credentials could be refreshed again later
+func stsUnreachable(err error) bool {
+	return stsUnavailable(err) || retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+}
+
+// stsUnavailable reports whether the error means the endpoint itself is unavailable,
+// after the SDK's own retries, rather than the request being rejected. Rejected requests
+// would only be rejected again in another region, and could use up an MFA code
+func stsUnavailable(err error) bool {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() >= 500 {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,146 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "sudo",
+		usage: "run a single command with the profile's (elevated) role, e.g. sudo -p prod-admin -- cmd. The use is recorded in the audit log and the credentials are removed from the cache when the command exits",
+		run:   runSudo,
+	})
+}
+
+// Variables that would point the child at a profile other than the elevated credentials
+var profileEnvVars = []string{"AWS_PROFILE", "AWS_DEFAULT_PROFILE"}
+
+func runSudo(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageKeep        = "keep the credentials in the cache after the command exits"
+		usageMaxChildren = "limit how many commands may run with the profile's credentials at once. Others wait for one to exit. 0 is unlimited"
+	)
+	var keep bool
+	var maxChildren int
+
+	addCredentialFlags(fs)
+	fs.BoolVar(&keep, "keep", false, usageKeep)
+	fs.IntVar(&maxChildren, "max-children", 0, usageMaxChildren)
+	fs.Parse(args)
+
+	argv := fs.Args()
+	if len(argv) == 0 {
+		return fmt.Errorf("sudo requires a command to run, e.g. sudo -p prod-admin -- aws s3 ls")
+	}
+
+	if maxChildren > 0 {
+		release, err := acquireSlot(ctx, "sudo-"+profileOrDefault(), maxChildren)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Nothing elevated is left behind, including an entry that was cached before this
+	// command ran, unless it is explicitly kept
+	if !keep && !noCache {
+		defer func() {
+			if err := src.cache().remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("warning: failed to remove cached credentials, %v", err)
+			}
+		}()
+	}
+
+	creds, err := src.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	event := auditEvent{Action: "sudo", Profile: profileOrDefault(), RoleArn: src.cacheKey.RoleArn, Command: argv}
+	if err := audit(event); err != nil {
+		return err
+	}
+
+	env := os.Environ()
+	for _, key := range profileEnvVars {
+		env = unsetEnv(env, key)
+	}
+	env = append(env,
+		"AWS_ACCESS_KEY_ID="+creds.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY="+creds.SecretAccessKey,
+		"AWS_SESSION_TOKEN="+creds.SessionToken,
+	)
+	env = append(env, src.stats.env()...)
+	if os.Getenv("AWS_REGION") == "" && src.region != "" {
+		env = append(env, "AWS_REGION="+src.region)
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// The child can't be given new credentials, so a long deploy should at least not be cut
+	// short by surprise
+	defer notifyBeforeExpiry(creds, fmt.Sprintf("%s will lose access then", argv[0]))()
+
+	// The child gets Ctrl-C from the terminal itself. Ignoring it here makes sure
+	// the audit log and cache cleanup still happen after the child exits
+	signal.Ignore(os.Interrupt)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run %s, %w", argv[0], err)
+	}
+	// SIGTERM and SIGHUP, e.g. from a stopped CI job or a closed terminal, only reach
+	// this process, so they're passed on and the cleanup happens once the child exits
+	defer forwardSignals(func(sig os.Signal) {
+		if err := cmd.Process.Signal(sig); err != nil {
+			cmd.Process.Kill() // Windows can't deliver signals
+		}
+	})()
+
+	runErr := cmd.Wait()
+	exitCode := cmd.ProcessState.ExitCode()
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		// The status a shell reports for a child stopped by a signal
+		exitCode = 128 + int(status.Signal())
+	}
+
+	event.Action = "sudo-exit"
+	event.ExitCode = &exitCode
+	if err := audit(event); err != nil {
+		log.Printf("warning: %v", err)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		return &exitCodeError{code: exitCode}
+	}
+	return runErr
+}
+
+// unsetEnv removes key from an os.Environ style list
+func unsetEnv(env []string, key string) []string {
+	out := env[:0]
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, key+"=") {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"runtime"
+	"testing"
+
+	"github.com/ryandeivert/aws-cred-proc/pkg/cache"
+)
+
+// sudoWrap prints credentials the way a credential_process does, so sudo runs without STS
+const sudoWrap = `printf '{"Version": 1, "AccessKeyId": "ASIASUDO", "SecretAccessKey": "secret", "SessionToken": "token", "Expiration": "2099-01-01T00:00:00Z"}'`
+
+// runTestSudo runs the sudo command with args, returning its error and the cache entries
+// left behind
+func runTestSudo(t *testing.T, backend *cache.MemoryBackend, args ...string) ([]string, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("sudo", flag.ContinueOnError)
+	err := runSudo(context.Background(), fs, append([]string{"-cache-backend", "memory", "-wrap", sudoWrap}, args...))
+	names, listErr := backend.List()
+	if listErr != nil {
+		t.Fatal(listErr)
+	}
+	return names, err
+}
+
+func TestSudoRemovesCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credentials are printed with sh")
+	}
+	useTempHome(t)
+	useConfig(t, "", "")
+	resetCredentialFlags(t)
+	backend := cache.NewMemoryBackend()
+	prev := memoryCache
+	memoryCache = backend
+	t.Cleanup(func() { memoryCache = prev })
+
+	names, err := runTestSudo(t, backend, "-keep", "--", "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Fatalf("-keep left %d cache entries, want 1", len(names))
+	}
+
+	// Including the one cached before it ran
+	names, err = runTestSudo(t, backend, "--", "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("left cache entries %v", names)
+	}
+
+	// And when the command fails, whose exit code is passed on
+	names, err = runTestSudo(t, backend, "--", "sh", "-c", "exit 3")
+	var exitErr *exitCodeError
+	if !errors.As(err, &exitErr) || exitErr.code != 3 {
+		t.Errorf("runSudo() error = %v, want exit status 3", err)
+	}
+	if len(names) != 0 {
+		t.Errorf("left cache entries %v after the command failed", names)
+	}
+}
@@ -0,0 +1,127 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/ryandeivert/aws-cred-proc/pkg/mfa"
+	"github.com/ryandeivert/aws-cred-proc/pkg/output"
+)
+
+// Names of the credentials, passed with LoadCredential= or SetCredential=, that hold the source secrets
+const (
+	systemdAccessKeyCredential    = "aws_access_key_id"
+	systemdSecretKeyCredential    = "aws_secret_access_key"
+	systemdSessionTokenCredential = "aws_session_token"
+)
+
+// Default directories dependent units read credentials from with LoadCredential=<name>
+const (
+	systemdCredstoreDir          = "/run/credstore"
+	systemdEncryptedCredstoreDir = "/run/credstore.encrypted"
+)
+
+func readSystemdCredential(dir, name string, required bool) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) && !required {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read systemd credential %q, %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// systemdSourceCredentials reads static source credentials from the directory systemd
+// populates for the unit's LoadCredential=/SetCredential= settings
+func systemdSourceCredentials() (aws.CredentialsProvider, error) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return nil, fmt.Errorf("CREDENTIALS_DIRECTORY is not set, -systemd-creds must be used from a unit with LoadCredential= or SetCredential=")
+	}
+
+	accessKey, err := readSystemdCredential(dir, systemdAccessKeyCredential, true)
+	if err != nil {
+		return nil, err
+	}
+	secretKey, err := readSystemdCredential(dir, systemdSecretKeyCredential, true)
+	if err != nil {
+		return nil, err
+	}
+	sessionToken, err := readSystemdCredential(dir, systemdSessionTokenCredential, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewStaticCredentialsProvider(accessKey, secretKey, sessionToken), nil
+}
+
+// writeSystemdCredential stores the session, in the credential_process format, as a
+// credential named name that dependent units can load with LoadCredential=name (or
+// LoadCredentialEncrypted=name when encrypted with systemd-creds)
+func writeSystemdCredential(name string, creds aws.Credentials, encrypt bool) error {
+	data, err := json.Marshal(output.NewProcessCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("failed to encode systemd credential, %w", err)
+	}
+
+	dir := systemdCredstoreDir
+	if encrypt {
+		dir = systemdEncryptedCredstoreDir
+	}
+	if err := makeDirs(dir); err != nil {
+		return fmt.Errorf("failed to make credstore directory, %w", err)
+	}
+	path := filepath.Join(dir, name)
+
+	if !encrypt {
+		if err := writeFile(path, data); err != nil {
+			return fmt.Errorf("failed to write systemd credential, %w", err)
+		}
+		return nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("systemd-creds", "encrypt", "--name="+name, "-", path)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemd-creds encrypt failed, %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return enforceFileMode(path)
+}
+
+// systemdAskPassword prompts through systemd-ask-password, which reads from the TTY when there
+// is one and otherwise hands the prompt to the running password agents (the console agent,
+// Plymouth, a desktop agent, etc), so headless sessions and services can still answer it
+func systemdAskPassword(id, prompt string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("systemd-ask-password", "--id="+id, prompt)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("systemd-ask-password failed, %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// AskPasswordCode prompts for the MFA code through systemd-ask-password. The code is
+// echoed since, unlike a password, it is only valid for a short time
+func AskPasswordCode(mfaSerial *string) func() (string, error) {
+	return func() (string, error) {
+		prompt := "MFA Code:"
+		if mfaSerial != nil {
+			prompt = fmt.Sprintf("MFA Code for %s:", *mfaSerial)
+		}
+		return mfa.Command("systemd-ask-password", "--id=aws-cred-proc:mfa", "--echo", prompt)
+	}
+}
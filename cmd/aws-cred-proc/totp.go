@@ -0,0 +1,106 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-tty"
+	"github.com/ryandeivert/aws-cred-proc/pkg/mfa"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "totp",
+		usage: "manage TOTP seeds stored in the OS keyring for use with -mfa-totp. Subcommands: add, remove, code",
+		run:   runTOTP,
+	})
+}
+
+// totpKeyringAccount is the keyring account the seed for an MFA device is stored under
+func totpKeyringAccount(mfaSerial string) string {
+	return "totp:" + mfaSerial
+}
+
+// TOTPCode returns a token provider that computes the MFA code from the seed
+// stored in the OS keyring for the given MFA device
+func TOTPCode(mfaSerial *string) func() (string, error) {
+	return func() (string, error) {
+		seed, err := keyringGet(totpKeyringAccount(*mfaSerial))
+		if errors.Is(err, errKeyringNotFound) {
+			return "", fmt.Errorf("no TOTP seed stored for %q, add one with `aws-cred-proc totp add`", *mfaSerial)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return mfa.TOTPSeed(seed)()
+	}
+}
+
+func readSeed() (string, error) {
+	tty, err := tty.Open()
+	if err != nil {
+		return "", err
+	}
+	defer tty.Close()
+	defer onAbort(func() { tty.Close() })()
+
+	fmt.Fprint(tty.Output(), "TOTP Seed (base32): ")
+	return tty.ReadPassword()
+}
+
+func runTOTP(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageSerial = "the MFA device ARN (mfa_serial) the seed belongs to (required)"
+	)
+	var serial string
+	fs.StringVar(&serial, "serial", "", usageSerial)
+	fs.StringVar(&serial, "s", "", shorthandPrefix+"-serial")
+
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("totp requires one of: add, remove, code")
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	if serial == "" {
+		return fmt.Errorf("totp %s requires -serial", action)
+	}
+	account := totpKeyringAccount(serial)
+
+	switch action {
+	case "add":
+		seed, err := readSeed()
+		if err != nil {
+			return err
+		}
+		// Validate before storing so a typo isn't discovered at the next refresh
+		if _, err := mfa.DecodeSeed(seed); err != nil {
+			return err
+		}
+		if err := keyringSet(account, seed); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Stored TOTP seed for %q\n", serial)
+	case "remove":
+		if err := keyringDelete(account); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Removed TOTP seed for %q\n", serial)
+	case "code":
+		code, err := TOTPCode(&serial)()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, code)
+	default:
+		return fmt.Errorf("unknown totp subcommand %q", action)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// unusedStreakWarning is the number of sessions in a row that must go unused before
+// a profile is flagged by the stats command
+const unusedStreakWarning = 3
+
+// usageRetention is how long an entry is kept after its sessions were last minted or
+// read, so entries of old profiles and one-off roles don't pile up
+const usageRetention = 30 * 24 * time.Hour
+
+// recordUsageStats enables recording usage, set with -usage-stats
+var recordUsageStats bool
+
+// usageLockTimeout is how long recordUsage waits for another process updating the stats,
+// which only takes as long as reading and writing the file
+const usageLockTimeout = 2 * time.Second
+
+// usageEntry tracks how the sessions of one cache entry are used
+type usageEntry struct {
+	Profile    string
+	Minted     int
+	Unused     int // sessions that were replaced without ever being read from the cache
+	Streak     int // the number of those in a row, up to the latest replaced session
+	LastMinted time.Time
+	LastRead   time.Time `json:",omitempty"`
+	Expires    time.Time // of the current session
+	Reads      int       // of the current session, from the cache
+}
+
+// wasted reports whether the entry's sessions are repeatedly minted but never used,
+// counting the current session if it has expired unread
+func (e *usageEntry) wasted() (int, bool) {
+	streak := e.Streak
+	if e.Reads == 0 && time.Now().After(e.Expires) {
+		streak++
+	}
+	return streak, streak >= unusedStreakWarning
+}
+
+type usageStats map[string]*usageEntry
+
+func usagePath() string {
+	return filepath.Join(stateDir(), "usage.json")
+}
+
+func loadUsage() (usageStats, error) {
+	stats := usageStats{}
+	data, err := os.ReadFile(usagePath())
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage stats, %w", err)
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("failed to decode usage stats, %w", err)
+	}
+	return stats, nil
+}
+
+// prune removes the entries not used within usageRetention
+func (s usageStats) prune(now time.Time) {
+	for key, entry := range s {
+		last := entry.LastMinted
+		if entry.LastRead.After(last) {
+			last = entry.LastRead
+		}
+		if now.Sub(last) > usageRetention {
+			delete(s, key)
+		}
+	}
+}
+
+func (s usageStats) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode usage stats, %w", err)
+	}
+	if err := makeDirs(stateDir()); err != nil {
+		return fmt.Errorf("failed to make directories, %w", err)
+	}
+	// The stats are only a summary, so aren't worth syncing on every credential request
+	return writeFileRenamed(usagePath(), data, false)
+}
+
+// recordUsage updates the stats for the cache entry with key, with -usage-stats. minted
+// is true when creds are a new session, and false when they were read from the cache.
+// Tracking is best effort, so failures are ignored rather than failing the credential
+// request
+func recordUsage(key string, creds aws.Credentials, minted bool) {
+	if !recordUsageStats {
+		return
+	}
+	// Processes started together, like the providers of a terraform run, would otherwise
+	// lose each other's updates
+	ctx, cancel := context.WithTimeout(context.Background(), usageLockTimeout)
+	defer cancel()
+	release, err := acquireSlot(ctx, "usage", 1)
+	if err != nil {
+		return
+	}
+	defer release()
+
+	stats, err := loadUsage()
+	if err != nil {
+		// Without syncs, a crash can leave the stats truncated, so start over
+		stats = usageStats{}
+	}
+	now := time.Now()
+	stats.prune(now)
+	entry, ok := stats[key]
+	if !ok {
+		entry = &usageEntry{}
+		stats[key] = entry
+	}
+	entry.Profile = profileOrDefault()
+
+	if minted {
+		if entry.Minted > 0 {
+			if entry.Reads == 0 {
+				entry.Unused++
+				entry.Streak++
+			} else {
+				entry.Streak = 0
+			}
+		}
+		entry.Minted++
+		entry.LastMinted = now
+		entry.Expires = creds.Expires
+		entry.Reads = 0
+	} else {
+		entry.Reads++
+		entry.LastRead = now
+	}
+	stats.save()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "version",
+		usage: "print the version, commit and build date of this binary, along with the Go and AWS SDK versions it was built with",
+		run:   runVersion,
+	})
+}
+
+// Set at build time with -ldflags "-X main.version=...", see the Makefile. When they
+// are not, they are filled in from the build info Go embeds, where it has them
+var version, commit, buildDate string
+
+// buildMetadata describes the binary
+type buildMetadata struct {
+	Version   string
+	Commit    string
+	Modified  bool
+	BuildDate string
+	Tags      string
+	GoVersion string
+	Platform  string
+}
+
+func readBuildMetadata() buildMetadata {
+	m := buildMetadata{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return m
+	}
+	// go install sets the module version, go build from a checkout sets the VCS info
+	if m.Version == "" && info.Main.Version != "(devel)" {
+		m.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if m.Commit == "" {
+				m.Commit = setting.Value
+			}
+		case "vcs.time":
+			if m.BuildDate == "" {
+				m.BuildDate = setting.Value
+			}
+		case "vcs.modified":
+			m.Modified = setting.Value == "true"
+		case "-tags":
+			m.Tags = setting.Value
+		}
+	}
+	return m
+}
+
+func runVersion(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+
+	m := readBuildMetadata()
+	unknown := func(value string) string {
+		if value == "" {
+			return "unknown"
+		}
+		return value
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	line := func(label, format string, a ...any) {
+		fmt.Fprintf(w, "%s:\t%s\n", label, fmt.Sprintf(format, a...))
+	}
+	line("version", "%s", unknown(m.Version))
+	if m.Modified {
+		line("commit", "%s (modified)", unknown(m.Commit))
+	} else {
+		line("commit", "%s", unknown(m.Commit))
+	}
+	line("built", "%s", unknown(m.BuildDate))
+	if m.Tags != "" {
+		line("build tags", "%s", m.Tags)
+	}
+	line("go", "%s %s", m.GoVersion, m.Platform)
+	line("aws sdk", "%s", aws.SDKVersion)
+	return w.Flush()
+}
@@ -0,0 +1,76 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	// watchRetryDelay is how long -watch waits to try again after a refresh fails
+	watchRetryDelay = time.Minute
+	// watchMinInterval keeps -watch from refreshing in a loop when even new credentials
+	// expire within -expiry-window, e.g. the 1 hour limit of role chaining
+	watchMinInterval = time.Minute
+)
+
+// notifyBeforeExpiry shows a desktop notification -notify-before the credentials expire,
+// unless the returned func is called first. hint says what to do about it
+func notifyBeforeExpiry(creds aws.Credentials, hint string) func() {
+	if !creds.CanExpire || notifyBefore <= 0 || noNotify {
+		return func() {}
+	}
+	timer := time.AfterFunc(time.Until(creds.Expires.Add(-notifyBefore)), func() {
+		desktopNotify("aws-cred-proc", fmt.Sprintf("The credentials for profile %s expire at %s. %s",
+			profileOrDefault(), creds.Expires.Local().Format(time.Kitchen), hint))
+	})
+	return func() { timer.Stop() }
+}
+
+// watchCredentials writes the credentials with write, then keeps refreshing and writing
+// them -expiry-window before they expire until the process is stopped. Credentials that
+// don't expire are only written once
+func watchCredentials(ctx context.Context, src *credentialSource, write func(aws.Credentials) error) error {
+	creds, err := src.load(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		if err := write(creds); err != nil {
+			return err
+		}
+		if !creds.CanExpire {
+			return nil
+		}
+
+		wait := max(time.Until(creds.Expires.Add(-expiryWindow)), watchMinInterval)
+		fmt.Fprintf(os.Stderr, "Credentials for %q valid until %s, refreshing in %s\n", profileOrDefault(),
+			creds.Expires.Local().Format(time.RFC1123), wait.Round(time.Second))
+		time.Sleep(wait)
+
+		// A failed refresh is retried rather than ending the watch, since the network may
+		// come back or the MFA prompt may just have been missed. Meanwhile a login, which
+		// the notification suggests, fills the cache the next attempt reads
+		current := creds
+		var stopNotice func()
+		for {
+			if creds, err = src.load(ctx); err == nil {
+				break
+			}
+			log.Printf("warning: failed to refresh credentials, retrying in %s, %v", watchRetryDelay, err)
+			if stopNotice == nil {
+				stopNotice = notifyBeforeExpiry(current, fmt.Sprintf("Run aws-cred-proc login -p %s to renew them", profileOrDefault()))
+			}
+			time.Sleep(watchRetryDelay)
+		}
+		if stopNotice != nil {
+			stopNotice()
+		}
+	}
+}
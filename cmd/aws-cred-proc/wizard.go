@@ -0,0 +1,188 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/processcreds"
+	"github.com/ryandeivert/aws-cred-proc/internal/shell"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "init",
+		usage: "interactively add a credential_process profile to ~/.aws/config and verify it works",
+		run:   runInit,
+	})
+}
+
+// wizard reads answers from in and writes prompts to out
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (w *wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	answer, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || answer == "") {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+func (w *wizard) confirm(question string, def bool) (bool, error) {
+	d := "y/N"
+	if def {
+		d = "Y/n"
+	}
+	answer, err := w.ask(question+" ("+d+")", "")
+	if err != nil || answer == "" {
+		return def, err
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
+
+func (w *wizard) choose(question string, options []string, def int) (int, error) {
+	for i, option := range options {
+		fmt.Fprintf(w.out, "  %d) %s\n", i+1, option)
+	}
+	for {
+		answer, err := w.ask(question, strconv.Itoa(def+1))
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && 1 <= n && n <= len(options) {
+			return n - 1, nil
+		}
+		fmt.Fprintf(w.out, "Please enter a number between 1 and %d\n", len(options))
+	}
+}
+
+func runInit(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+
+	path := sharedConfigPath()
+	cfg, err := loadINI(path)
+	if err != nil {
+		return err
+	}
+
+	// Offer the profiles that assume a role, since those are the ones that benefit
+	var roleProfiles []string
+	for _, section := range cfg.sections() {
+		if _, ok := cfg.get(section, "role_arn"); ok {
+			roleProfiles = append(roleProfiles, profileFromSection(section))
+		}
+	}
+	if len(roleProfiles) == 0 {
+		return fmt.Errorf("no profiles with a role_arn found in %s. See the README for how to configure one", path)
+	}
+
+	fmt.Fprintf(w.out, "Found %d role profile(s) in %s:\n", len(roleProfiles), path)
+	choice, err := w.choose("Which profile should credentials be vended for?", roleProfiles, 0)
+	if err != nil {
+		return err
+	}
+	target := roleProfiles[choice]
+	targetSection := configSectionName(target)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable, %w", err)
+	}
+	command := []string{exe, "--profile", target}
+
+	if _, ok := cfg.get(targetSection, "mfa_serial"); ok {
+		providers := []string{"prompt for the code on the terminal", "read the code from a YubiKey"}
+		choice, err := w.choose("How should MFA codes be provided?", providers, 0)
+		if err != nil {
+			return err
+		}
+		if choice == 1 {
+			command = append(command, "--mfa-yk")
+		}
+	}
+
+	useCache, err := w.confirm("Cache credentials in ~/.aws/cli/cache (shared with the aws CLI)?", true)
+	if err != nil {
+		return err
+	}
+	if !useCache {
+		command = append(command, "--no-cache")
+	}
+
+	name, err := w.ask("Name of the profile to add", target+"-cred-proc")
+	if err != nil {
+		return err
+	}
+	section := configSectionName(name)
+	if _, exists := cfg.get(section, "credential_process"); exists {
+		overwrite, err := w.confirm(fmt.Sprintf("Profile %q already has a credential_process, replace it?", name), false)
+		if err != nil || !overwrite {
+			return err
+		}
+	}
+
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = shell.QuoteArg(arg)
+	}
+	line := strings.Join(quoted, " ")
+	fmt.Fprintf(w.out, "\nThe following will be written to %s:\n\n[%s]\ncredential_process = %s\n\n", path, section, line)
+	ok, err := w.confirm("Continue?", true)
+	if err != nil || !ok {
+		return err
+	}
+
+	if len(cfg.lines) > 0 {
+		backup := fmt.Sprintf("%s.bak.%s", path, time.Now().Format("20060102150405"))
+		if err := writeFile(backup, cfg.bytes()); err != nil {
+			return fmt.Errorf("failed to back up %s, %w", path, err)
+		}
+		fmt.Fprintf(w.out, "Backed up the existing config to %s\n", backup)
+	}
+
+	cfg.set(section, "credential_process", line)
+	if err := writeFile(path, cfg.bytes()); err != nil {
+		return fmt.Errorf("failed to write %s, %w", path, err)
+	}
+
+	verify, err := w.confirm("Run a verification test now?", true)
+	if err != nil || !verify {
+		return err
+	}
+
+	// Run the profile as written, so a line the SDK can't run fails here rather than later
+	written, err := loadSharedProfile(ctx, name)
+	if err != nil {
+		return fmt.Errorf("verification failed, %w", err)
+	}
+	creds, err := processcreds.NewProvider(written.CredentialProcess).Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("verification failed, %w", err)
+	}
+	fmt.Fprintf(w.out, "Success! Credentials for %q expire at %s\n", target, creds.Expires.Local().Format(time.RFC1123))
+	fmt.Fprintf(w.out, "Use them with: aws --profile %s sts get-caller-identity\n", name)
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/processcreds"
+)
+
+// newWrapSource returns the credential source for -wrap. The command is run the same
+// way the SDK runs a credential_process, with stdin and stderr passed through for any
+// prompts, and its credentials are cached under a key of the command line
+func newWrapSource(ctx context.Context) (*credentialSource, error) {
+	region, regionSource := resolveRegion(ctx)
+	return &credentialSource{
+		provider:     processcreds.NewProvider(wrapCommand),
+		cacheKey:     computableCacheKey{WrapCommand: wrapCommand},
+		region:       region,
+		regionSource: regionSource,
+	}, nil
+}
@@ -0,0 +1,79 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "write-profile",
+		usage: "write the credentials to a section of the shared credentials file, for legacy tools that only read ~/.aws/credentials",
+		run:   runWriteProfile,
+	})
+}
+
+func runWriteProfile(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	const (
+		usageSection = "the credentials file section (profile name) to write the credentials to (required)"
+		usageWatch   = "keep running, refreshing the credentials -expiry-window before they expire and rewriting the section each time. MFA prompts come with a desktop notification"
+	)
+	var section string
+
+	addCredentialFlags(fs)
+	fs.StringVar(&section, "section", "", usageSection)
+	fs.StringVar(&section, "s", "", shorthandPrefix+"-section")
+	fs.BoolVar(&watchMode, "watch", false, usageWatch)
+	fs.Parse(args)
+
+	if section == "" {
+		return fmt.Errorf("write-profile requires -section")
+	}
+	// Static keys in the credentials file take precedence over the profile's role, so
+	// writing to the source profile would shadow it with credentials that expire
+	if section == profileOrDefault() {
+		return fmt.Errorf("write-profile -section must differ from the profile the credentials are resolved from")
+	}
+
+	src, err := newCredentialSource(ctx)
+	if err != nil {
+		return err
+	}
+	write := func(creds aws.Credentials) error {
+		path := sharedCredentialsPath()
+		file, err := loadINI(path)
+		if err != nil {
+			return err
+		}
+		file.set(section, "aws_access_key_id", creds.AccessKeyID)
+		file.set(section, "aws_secret_access_key", creds.SecretAccessKey)
+		if creds.SessionToken != "" {
+			file.set(section, "aws_session_token", creds.SessionToken)
+		}
+		if creds.CanExpire {
+			file.set(section, "aws_session_expiration", creds.Expires.UTC().Format(time.RFC3339))
+		}
+
+		if err := writeFileAtomic(path, file.bytes()); err != nil {
+			return fmt.Errorf("failed to write %s, %w", path, err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote credentials for %q to the [%s] section of %s\n", profileOrDefault(), section, path)
+		return nil
+	}
+
+	if watchMode {
+		return watchCredentials(ctx, src, write)
+	}
+	creds, err := src.load(ctx)
+	if err != nil {
+		return err
+	}
+	return write(creds)
+}
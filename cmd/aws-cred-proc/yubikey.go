@@ -0,0 +1,389 @@
+//go:build !credproc_min
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ebfe/scard"
+	"github.com/mattn/go-tty"
+	"github.com/ryandeivert/aws-cred-proc/pkg/mfa"
+)
+
+// A minimal client for the YubiKey OATH application, talking to the key over PC/SC,
+// see https://developers.yubico.com/OATH/YKOATH_Protocol.html. Unlike ykoath, this
+// can choose between several attached keys by their serial number
+
+var (
+	oathAID       = []byte{0xa0, 0x00, 0x00, 0x05, 0x27, 0x21, 0x01}
+	managementAID = []byte{0xa0, 0x00, 0x00, 0x05, 0x27, 0x47, 0x11, 0x17}
+	otpAID        = []byte{0xa0, 0x00, 0x00, 0x05, 0x27, 0x20, 0x01}
+)
+
+const (
+	insSelect        = 0xa4
+	insCalculate     = 0xa2
+	insCalculateAll  = 0xa4
+	insValidate      = 0xa3
+	insSendRemaining = 0xa5
+	insDeviceInfo    = 0x1d
+	insOTPSerial     = 0x01
+
+	tagName          = 0x71
+	tagChallenge     = 0x74
+	tagResponse      = 0x75
+	tagTruncated     = 0x76
+	tagHOTP          = 0x77
+	tagTouch         = 0x7c
+	tagDeviceSerial  = 0x02
+	swSuccess        = 0x9000
+	swMoreDataPrefix = 0x61
+
+	// Returned by CALCULATE when the key was not touched in time
+	swSecurityNotSatisfied   = 0x6982
+	swConditionsNotSatisfied = 0x6985
+)
+
+var errNoYubiKey = errors.New("no YubiKey found")
+
+// apduError is a status word other than success returned by the YubiKey
+type apduError struct {
+	sw uint16
+}
+
+func (e *apduError) Error() string {
+	return fmt.Sprintf("YubiKey returned status %04x", e.sw)
+}
+
+func isTouchTimeout(err error) bool {
+	var apduErr *apduError
+	return errors.As(err, &apduErr) && (apduErr.sw == swSecurityNotSatisfied || apduErr.sw == swConditionsNotSatisfied)
+}
+
+func MFAYKCode(mfaSerial *string) func() (string, error) {
+	return func() (string, error) {
+		yk, err := openYubiKey(yubiKeySerial())
+		if err != nil {
+			return "", err
+		}
+		defer yk.Close()
+		defer onAbort(func() { yk.Close() })()
+
+		if err := yk.unlock(); err != nil {
+			return "", err
+		}
+
+		return yk.calculate(oathCredentialName(*mfaSerial), time.Now(), ykTouchRetries, func(name string, attempt int) error {
+			// credential_process is often run by background tools where the tty message
+			// goes unseen, so also show a notification on the desktop
+			if !noNotify {
+				desktopNotify("aws-cred-proc", fmt.Sprintf("Touch your YubiKey for profile %s", profileOrDefault()))
+			}
+
+			// Using tty so the message does not get captured by awscli in stdout/stderr
+			tty, err := tty.Open()
+			if err != nil {
+				return err
+			}
+			defer tty.Close()
+
+			if attempt > 0 {
+				fmt.Fprintf(tty.Output(), "YubiKey was not touched in time, retrying (%d of %d)\n", attempt, ykTouchRetries)
+			}
+			fmt.Fprint(tty.Output(), fmt.Sprintf("Please touch YubiKey now to generate MFA code for %q...\n", name))
+			return nil
+		})
+	}
+}
+
+// yubiKeySerial returns the serial number of the YubiKey to use, from -yk-serial
+// or the yubikey_serial setting of the profile, if either is set
+func yubiKeySerial() string {
+	if ykSerial != "" {
+		return ykSerial
+	}
+	return profileSetting("yubikey_serial")
+}
+
+// oathCredentialName returns the name of the OATH credential holding the seed for the
+// MFA device. This is the mfa_serial ARN unless the profile maps it to another name
+// with yubikey_oath_name, e.g. "aws-prod" or "Amazon Web Services:me@prod"
+func oathCredentialName(mfaSerial string) string {
+	if name := profileSetting("yubikey_oath_name"); name != "" {
+		return name
+	}
+	return mfaSerial
+}
+
+type yubiKey struct {
+	ctx  *scard.Context
+	card *scard.Card
+
+	// From the OATH SELECT response. The challenge is only set when the
+	// application is password protected
+	deviceID  []byte
+	challenge []byte
+}
+
+// isYubiKeyReader filters the PC/SC readers to those belonging to a YubiKey
+func isYubiKeyReader(reader string) bool {
+	return strings.Contains(strings.ToLower(reader), "yubico")
+}
+
+// openYubiKey connects to the YubiKey with the given serial number and selects the
+// OATH application. The first YubiKey found is used when serial is empty
+func openYubiKey(serial string) (*yubiKey, error) {
+	ctx, err := scard.EstablishContext()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the smart card service, %w", err)
+	}
+
+	readers, err := ctx.ListReaders()
+	if err != nil {
+		ctx.Release()
+		return nil, fmt.Errorf("failed to list smart card readers, %w", err)
+	}
+
+	var found []string
+	for _, reader := range readers {
+		if !isYubiKeyReader(reader) {
+			continue
+		}
+		card, err := ctx.Connect(reader, scard.ShareShared, scard.ProtocolAny)
+		if err != nil {
+			continue
+		}
+		yk := &yubiKey{ctx: ctx, card: card}
+
+		if serial != "" {
+			s, err := yk.serial()
+			if err != nil || s != serial {
+				if s != "" {
+					found = append(found, s)
+				}
+				card.Disconnect(scard.LeaveCard)
+				continue
+			}
+		}
+
+		resp, err := yk.selectApplication(oathAID)
+		if err != nil {
+			yk.Close()
+			return nil, err
+		}
+		for _, field := range mfa.ParseTLV(resp) {
+			switch field.Tag {
+			case tagName:
+				yk.deviceID = field.Value
+			case tagChallenge:
+				yk.challenge = field.Value
+			}
+		}
+		return yk, nil
+	}
+
+	ctx.Release()
+	if serial != "" {
+		return nil, fmt.Errorf("%w with serial %s, found: %s", errNoYubiKey, serial, strings.Join(found, ", "))
+	}
+	return nil, errNoYubiKey
+}
+
+func (y *yubiKey) Close() error {
+	y.card.Disconnect(scard.LeaveCard)
+	return y.ctx.Release()
+}
+
+// transmit sends an APDU, collecting the full response if the key splits it up
+func (y *yubiKey) transmit(ins, p1, p2 byte, data []byte) ([]byte, error) {
+	apdu := append([]byte{0x00, ins, p1, p2, byte(len(data))}, data...)
+
+	var out []byte
+	for {
+		resp, err := y.card.Transmit(apdu)
+		if err != nil {
+			return nil, fmt.Errorf("failed to communicate with YubiKey, %w", err)
+		}
+		if len(resp) < 2 {
+			return nil, fmt.Errorf("short response from YubiKey")
+		}
+		body, sw1, sw2 := resp[:len(resp)-2], resp[len(resp)-2], resp[len(resp)-1]
+		out = append(out, body...)
+
+		if sw1 == swMoreDataPrefix {
+			apdu = []byte{0x00, insSendRemaining, 0x00, 0x00}
+			continue
+		}
+		if sw := uint16(sw1)<<8 | uint16(sw2); sw != swSuccess {
+			return nil, &apduError{sw: sw}
+		}
+		return out, nil
+	}
+}
+
+func (y *yubiKey) selectApplication(aid []byte) ([]byte, error) {
+	return y.transmit(insSelect, 0x04, 0x00, aid)
+}
+
+// serial reads the serial number from the management application, falling back on
+// the OTP application for keys older than the YubiKey 5
+func (y *yubiKey) serial() (string, error) {
+	if _, err := y.selectApplication(managementAID); err == nil {
+		if info, err := y.transmit(insDeviceInfo, 0x00, 0x00, nil); err == nil && len(info) > 0 {
+			// The first byte is the length of the TLV encoded info that follows
+			for _, field := range mfa.ParseTLV(info[1:]) {
+				if field.Tag == tagDeviceSerial && len(field.Value) == 4 {
+					return strconv.FormatUint(uint64(binary.BigEndian.Uint32(field.Value)), 10), nil
+				}
+			}
+		}
+	}
+
+	if _, err := y.selectApplication(otpAID); err != nil {
+		return "", err
+	}
+	resp, err := y.transmit(insOTPSerial, 0x10, 0x00, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(resp) != 4 {
+		return "", fmt.Errorf("unexpected serial number response from YubiKey")
+	}
+	return strconv.FormatUint(uint64(binary.BigEndian.Uint32(resp)), 10), nil
+}
+
+// oathKeyringAccount is the keyring account the OATH key for a YubiKey is remembered under
+func oathKeyringAccount(deviceID []byte) string {
+	return "oath:" + hex.EncodeToString(deviceID)
+}
+
+// unlock performs the VALIDATE handshake when the OATH application is password
+// protected. The derived key is remembered in the OS keyring once it works, the same
+// way ykman does, so the password is only prompted for the first time
+func (y *yubiKey) unlock() error {
+	if y.challenge == nil {
+		return nil
+	}
+
+	account := oathKeyringAccount(y.deviceID)
+	if stored, err := keyringGet(account); err == nil {
+		if key, err := hex.DecodeString(stored); err == nil && y.validate(key) == nil {
+			return nil
+		}
+		// The password was changed or removed, so forget the old key
+		keyringDelete(account)
+	}
+
+	password, err := promptPassword("aws-cred-proc:oath", "YubiKey OATH Password:")
+	if err != nil {
+		return err
+	}
+	key := mfa.OATHKey(password, y.deviceID)
+	if err := y.validate(key); err != nil {
+		return err
+	}
+
+	if err := keyringSet(account, hex.EncodeToString(key)); err != nil {
+		// Not fatal, the password will just be prompted for again next time
+		log.Printf("warning: failed to save YubiKey OATH key, %v", err)
+	}
+	return nil
+}
+
+// validate proves knowledge of the key to the YubiKey, and checks the key's
+// response to a challenge of our own so a spoofed device is not trusted
+func (y *yubiKey) validate(key []byte) error {
+	mac := hmac.New(sha1.New, key)
+	mac.Write(y.challenge)
+	response := mac.Sum(nil)
+
+	challenge := make([]byte, 8)
+	if _, err := rand.Read(challenge); err != nil {
+		return err
+	}
+
+	resp, err := y.transmit(insValidate, 0x00, 0x00, append(mfa.EncodeTLV(tagResponse, response), mfa.EncodeTLV(tagChallenge, challenge)...))
+	if err != nil {
+		return fmt.Errorf("incorrect YubiKey OATH password, %w", err)
+	}
+
+	mac.Reset()
+	mac.Write(challenge)
+	for _, field := range mfa.ParseTLV(resp) {
+		if field.Tag == tagResponse && hmac.Equal(field.Value, mac.Sum(nil)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("YubiKey OATH response did not match")
+}
+
+// calculate returns the TOTP code for the named credential at time t. If the credential
+// requires the key to be touched, touch is called before each attempt, and a missed touch
+// is retried up to retries times
+func (y *yubiKey) calculate(name string, t time.Time, retries int, touch func(name string, attempt int) error) (string, error) {
+	challenge := mfa.TOTPChallenge(t)
+
+	// Calculating everything at once reveals whether the credential needs a touch
+	// without blocking on it, so the user can be told to touch the key
+	resp, err := y.transmit(insCalculateAll, 0x00, 0x01, mfa.EncodeTLV(tagChallenge, challenge))
+	if err != nil {
+		return "", err
+	}
+
+	fields := mfa.ParseTLV(resp)
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i].Tag != tagName || string(fields[i].Value) != name {
+			continue
+		}
+
+		result := fields[i+1]
+		switch result.Tag {
+		case tagTruncated:
+			return mfa.TruncatedCode(result.Value)
+		case tagHOTP:
+			return "", fmt.Errorf("YubiKey credential %q is HOTP, not TOTP", name)
+		case tagTouch:
+			return y.calculateTouch(name, t, retries, touch)
+		}
+	}
+	return "", fmt.Errorf("no OATH credential named %q on the YubiKey", name)
+}
+
+func (y *yubiKey) calculateTouch(name string, t time.Time, retries int, touch func(string, int) error) (string, error) {
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		if err := touch(name, attempt); err != nil {
+			return "", err
+		}
+		// Each attempt can wait several seconds for a touch, so keep the time step current
+		challenge := mfa.TOTPChallenge(t.Add(time.Since(start)))
+		data := append(mfa.EncodeTLV(tagName, []byte(name)), mfa.EncodeTLV(tagChallenge, challenge)...)
+
+		resp, err := y.transmit(insCalculate, 0x00, 0x01, data)
+		if isTouchTimeout(err) {
+			if attempt < retries {
+				continue
+			}
+			return "", fmt.Errorf("YubiKey was not touched in time, %w", err)
+		}
+		if err != nil {
+			return "", err
+		}
+		for _, field := range mfa.ParseTLV(resp) {
+			if field.Tag == tagTruncated {
+				return mfa.TruncatedCode(field.Value)
+			}
+		}
+		return "", fmt.Errorf("unexpected calculate response from YubiKey")
+	}
+}
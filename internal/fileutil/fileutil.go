@@ -0,0 +1,114 @@
+// Package fileutil writes files with an exact permission mode, atomically, for the
+// command and the packages that keep credentials on disk
+package fileutil
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// DirMode is mode with the execute (search) bit added wherever the read bit is set
+func DirMode(mode os.FileMode) os.FileMode {
+	return mode | (mode&0444)>>2
+}
+
+// MakeDirs creates path and any missing parents with DirMode(mode)
+func MakeDirs(path string, mode os.FileMode) error {
+	return os.MkdirAll(path, DirMode(mode))
+}
+
+// WriteAtomic writes data to path with mode through a temporary file in the same
+// directory that is renamed over path, so readers never see a partially written file.
+// With sync, the file is synced before the rename, so a crash can't leave path
+// truncated either. Files that can be lost in a crash skip the cost of the syncs
+func WriteAtomic(path string, data []byte, mode os.FileMode, sync bool) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil && sync {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := EnforceMode(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if sync {
+		syncDir(dir)
+	}
+	return nil
+}
+
+// syncDir makes a rename in dir durable. It's best effort, since directories can't be
+// synced on every platform, and the rename itself has already succeeded
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// EnforceMode sets mode on a file, which may have been written by another program,
+// and verifies the permissions took effect. Windows only supports the read-only
+// attribute, so the result is not verified there
+func EnforceMode(path string, mode os.FileMode) error {
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to set mode of %s, %w", path, err)
+	}
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if perm := info.Mode().Perm(); perm != mode {
+		return fmt.Errorf("%s has mode %04o after writing, expected %04o", path, uint32(perm), uint32(mode))
+	}
+	return nil
+}
+
+// Shred overwrites the file's contents with random data, flushing it to disk, before
+// removing it. This only helps on filesystems that overwrite in place, not on
+// copy-on-write or log-structured ones, or SSDs that remap writes
+func Shred(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := io.CopyN(f, rand.Reader, info.Size()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to overwrite %s, %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to flush %s, %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,43 @@
+// Package shell runs commands from settings the way the SDK runs a credential_process
+package shell
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Command runs command with sh -c, or cmd /C on Windows, the same as the SDK runs a
+// credential_process, so settings can quote arguments and use pipes
+func Command(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd.exe", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// posixSafe are the characters that never need quoting for sh
+const posixSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-./:@%+=,"
+
+// Quote returns s as a single word for sh, bash and zsh, single quoted unless it only
+// has characters that are never special
+func Quote(s string) string {
+	if s != "" && strings.Trim(s, posixSafe) == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// QuoteArg returns s as a single word of a command run by Command. cmd doesn't treat
+// single quotes as special, so on Windows it's double quoted instead, which is enough
+// for paths since they can't contain double quotes
+func QuoteArg(s string) string {
+	if runtime.GOOS != "windows" {
+		return Quote(s)
+	}
+	if s != "" && !strings.ContainsAny(s, " \t&()[]{}^=;!'+,`~%<>|\"") {
+		return s
+	}
+	return `"` + s + `"`
+}
@@ -0,0 +1,43 @@
+package shell
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/usr/local/bin/aws-cred-proc", "/usr/local/bin/aws-cred-proc"},
+		{"dev", "dev"},
+		{"", "''"},
+		{"/home/me/My Tools/aws-cred-proc", "'/home/me/My Tools/aws-cred-proc'"},
+		{"it's", `'it'\''s'`},
+		{"$(rm -rf ~)", "'$(rm -rf ~)'"},
+		{"a;b", "'a;b'"},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.in); got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// The quoted words must come back unchanged through the shell Command runs
+func TestQuoteArgRoundTrip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("echo in cmd prints its arguments as given")
+	}
+	for _, word := range []string{"plain", "with space", "it's", `back\slash`, "$HOME", "a\"b", "*"} {
+		out, err := Command(context.Background(), "printf %s "+QuoteArg(word)).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSuffix(string(out), "\n"); got != word {
+			t.Errorf("QuoteArg(%q) came back as %q", word, got)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ryandeivert/aws-cred-proc/internal/fileutil"
+)
+
+// Backend stores entries by name, the name the aws CLI gives the entry's file
+type Backend interface {
+	// Get returns the entry, or an error wrapping os.ErrNotExist if there is none
+	Get(name string) ([]byte, error)
+	// Put writes the entry, replacing it if it exists
+	Put(name string, data []byte) error
+	// Delete removes the entry, or returns an error wrapping os.ErrNotExist if there is none
+	Delete(name string) error
+	// List returns the names of the entries
+	List() ([]string, error)
+	// Location describes where the entry is kept, for messages
+	Location(name string) string
+}
+
+// ModTimer is implemented by backends that know when an entry was last written, which
+// lets concurrent forced refreshes tell whether another process just refreshed it
+type ModTimer interface {
+	ModTime(name string) (time.Time, error)
+}
+
+// Shredder is implemented by backends that can overwrite an entry before removing it
+type Shredder interface {
+	Shred(name string) error
+}
+
+// Slotter is implemented by backends that limit refreshes at once themselves, rather
+// than with lock files that other processes share. The returned func releases the slot
+type Slotter interface {
+	AcquireSlot(ctx context.Context, name string, slots int) (func(), error)
+}
+
+// DefaultDir is the directory the aws CLI caches assumed role credentials in
+func DefaultDir() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory, %w", err)
+	}
+	return filepath.Join(usr.HomeDir, ".aws", "cli", "cache"), nil
+}
+
+// FileBackend keeps entries as files in Dir, DefaultDir if it's empty, so they're
+// shared with the aws CLI. Files are written with Mode, 0600 if it's zero
+type FileBackend struct {
+	Dir  string
+	Mode os.FileMode
+}
+
+func (b FileBackend) dir() (string, error) {
+	if b.Dir != "" {
+		return b.Dir, nil
+	}
+	return DefaultDir()
+}
+
+func (b FileBackend) mode() os.FileMode {
+	if b.Mode != 0 {
+		return b.Mode
+	}
+	return 0600
+}
+
+// Path is the file the entry is kept in
+func (b FileBackend) Path(name string) (string, error) {
+	dir, err := b.dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+func (b FileBackend) Get(name string) ([]byte, error) {
+	path, err := b.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (b FileBackend) Put(name string, data []byte) error {
+	path, err := b.Path(name)
+	if err != nil {
+		return err
+	}
+	if err := fileutil.MakeDirs(filepath.Dir(path), b.mode()); err != nil {
+		return fmt.Errorf("failed to make directories, %w", err)
+	}
+	// Other processes may be reading the entry, and the aws CLI may be writing it
+	return fileutil.WriteAtomic(path, data, b.mode(), true)
+}
+
+func (b FileBackend) Delete(name string) error {
+	path, err := b.Path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (b FileBackend) List() ([]string, error) {
+	dir, err := b.dir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory, %w", err)
+	}
+	var names []string
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
+func (b FileBackend) Location(name string) string {
+	path, err := b.Path(name)
+	if err != nil {
+		return name
+	}
+	return path
+}
+
+func (b FileBackend) ModTime(name string) (time.Time, error) {
+	path, err := b.Path(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// Shred overwrites the entry with random data before removing it. This only helps on
+// filesystems that overwrite in place
+func (b FileBackend) Shred(name string) error {
+	path, err := b.Path(name)
+	if err != nil {
+		return err
+	}
+	return fileutil.Shred(path)
+}
+
+// MemoryBackend keeps entries in memory for the life of the process, for long running
+// programs that shouldn't write credentials anywhere. Since no other process shares
+// them, refreshes are limited within the process, without lock files
+type MemoryBackend struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	slots   map[string]chan struct{}
+}
+
+type memoryEntry struct {
+	data    []byte
+	written time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		entries: map[string]memoryEntry{},
+		slots:   map[string]chan struct{}{},
+	}
+}
+
+func (b *MemoryBackend) Get(name string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry, ok := b.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("no cache entry %s in memory, %w", name, os.ErrNotExist)
+	}
+	return entry.data, nil
+}
+
+func (b *MemoryBackend) Put(name string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[name] = memoryEntry{data: slices.Clone(data), written: time.Now()}
+	return nil
+}
+
+func (b *MemoryBackend) Delete(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.entries[name]; !ok {
+		return fmt.Errorf("no cache entry %s in memory, %w", name, os.ErrNotExist)
+	}
+	delete(b.entries, name)
+	return nil
+}
+
+func (b *MemoryBackend) List() ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names := make([]string, 0, len(b.entries))
+	for name := range b.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (b *MemoryBackend) Location(name string) string {
+	return fmt.Sprintf("memory entry %s", name)
+}
+
+func (b *MemoryBackend) ModTime(name string) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry, ok := b.entries[name]
+	if !ok {
+		return time.Time{}, os.ErrNotExist
+	}
+	return entry.written, nil
+}
+
+func (b *MemoryBackend) AcquireSlot(ctx context.Context, name string, slots int) (func(), error) {
+	b.mu.Lock()
+	sem, ok := b.slots[name]
+	if !ok {
+		sem = make(chan struct{}, slots)
+		b.slots[name] = sem
+	}
+	b.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
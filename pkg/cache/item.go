@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// SchemaVersion tags tool-native entries. Bump it, and add a case to Upgrade, for any
+// change older binaries would not be able to read
+const SchemaVersion = 1
+
+// expireTimeFormat is how botocore writes the expiration
+const expireTimeFormat = "2006-01-02T15:04:05+00:00"
+
+// Item is an entry as the aws CLI writes it, along with the fields only tool-native
+// entries have
+type Item struct {
+	Credentials   *Credentials
+	SchemaVersion int  `json:",omitempty"` // tool-native entries only, botocore ignores it
+	Key           *Key `json:",omitempty"` // tool-native entries only, the inputs of the entry's name
+}
+
+type Credentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      ExpireTime
+}
+
+type ExpireTime time.Time
+
+func (e ExpireTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Time(e).Format(expireTimeFormat))
+}
+
+func (e *ExpireTime) UnmarshalJSON(data []byte) error {
+	v := strings.Trim(string(data), `"`)
+	t, err := time.Parse(expireTimeFormat, v)
+	if err != nil {
+		return err
+	}
+	*e = ExpireTime(t)
+	return nil
+}
+
+// CorruptError is returned for entries that exist but can't be decoded, e.g. truncated
+// by a crash while another program was writing them
+type CorruptError struct {
+	Err error
+}
+
+func (e *CorruptError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CorruptError) Unwrap() error {
+	return e.Err
+}
+
+// NewItem returns an entry holding creds
+func NewItem(creds aws.Credentials) *Item {
+	return &Item{
+		Credentials: &Credentials{
+			AccessKeyId:     creds.AccessKeyID,
+			SecretAccessKey: creds.SecretAccessKey,
+			SessionToken:    creds.SessionToken,
+			Expiration:      ExpireTime(creds.Expires),
+		},
+	}
+}
+
+// Decode decodes an entry, returning a *CorruptError if it isn't valid json
+func Decode(data []byte) (*Item, error) {
+	var v Item
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, &CorruptError{fmt.Errorf("failed to decode cache json, %w", err)}
+	}
+	return &v, nil
+}
+
+// Encode encodes the entry as the aws CLI writes it
+func (i *Item) Encode() ([]byte, error) {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cache json, %w", err)
+	}
+	return data, nil
+}
+
+// Upgrade converts an entry written under an older schema version to the current one
+func (i *Item) Upgrade() error {
+	if i.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("cache entry schema version %d is newer than this binary supports", i.SchemaVersion)
+	}
+	// Untagged entries (version 0, including those from the aws CLI) already have the
+	// current layout, so there is nothing to convert until the schema changes
+	if i.Credentials == nil {
+		return &CorruptError{fmt.Errorf("cache entry has no credentials")}
+	}
+	i.SchemaVersion = SchemaVersion
+	return nil
+}
+
+// AWSCredentials returns the entry's credentials, which always expire
+func (i *Item) AWSCredentials() aws.Credentials {
+	return aws.Credentials{
+		AccessKeyID:     i.Credentials.AccessKeyId,
+		SecretAccessKey: i.Credentials.SecretAccessKey,
+		SessionToken:    i.Credentials.SessionToken,
+		CanExpire:       true, // The aws.Credentials.Expired() function needs this to be true
+		Expires:         time.Time(i.Credentials.Expiration),
+	}
+}
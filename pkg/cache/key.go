@@ -0,0 +1,96 @@
+// Package cache keeps credentials in the aws CLI's cache format, so processes using it
+// share sessions with each other and with the aws CLI itself
+package cache
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+)
+
+// Algorithms keys can be hashed with
+const (
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+)
+
+// Key is the inputs an entry's name is computed from.
+// Fields must remain in alphabetical order to match the sorted keys used by botocore
+type Key struct {
+	DurationSeconds int      `json:",omitempty"`
+	ExternalId      string   `json:",omitempty"`
+	IdentityPoolId  string   `json:",omitempty"` // Cognito only, never set by botocore
+	Logins          []string `json:",omitempty"` // Cognito only, never set by botocore
+	LoginsHash      string   `json:",omitempty"` // Cognito only, never set by botocore
+	MFASession      bool     `json:",omitempty"` // -mfa-session only, never set by botocore
+	PolicyHash      string   `json:",omitempty"` // never set by botocore
+	RoleArn         string   `json:",omitempty"`
+	RoleSessionName string   `json:",omitempty"` // botocore only includes this if it was provided
+	SerialNumber    string   `json:",omitempty"`
+	WrapCommand     string   `json:",omitempty"` // -wrap only, never set by botocore
+	// SSO roles only, as botocore's SSOCredentialFetcher sets them
+	AccountId   string `json:"accountId,omitempty"`
+	RoleName    string `json:"roleName,omitempty"`
+	SessionName string `json:"sessionName,omitempty"`
+	StartUrl    string `json:"startUrl,omitempty"`
+}
+
+// AssumeRoleKey returns the key botocore computes for the role the options assume
+func AssumeRoleKey(opts stscreds.AssumeRoleOptions) Key {
+	return Key{
+		DurationSeconds: int(opts.Duration.Seconds()),
+		ExternalId:      aws.ToString(opts.ExternalID),
+		RoleArn:         opts.RoleARN,
+		RoleSessionName: opts.RoleSessionName,
+		SerialNumber:    aws.ToString(opts.SerialNumber),
+		PolicyHash:      PolicyHash(aws.ToString(opts.Policy)),
+	}
+}
+
+// PolicyHash identifies a session policy in the key, without the key having to carry
+// the whole document
+func PolicyHash(policy string) string {
+	if policy == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(policy))
+	return hex.EncodeToString(sum[:])
+}
+
+// String is the key hashed with sha1, the name the aws CLI gives the entry's file
+func (k Key) String() string {
+	return k.Hash(HashSHA1)
+}
+
+// Hash is a loose approximation of the botocore
+// BaseAssumeRoleCredentialFetcher._create_cache_key function, hashed with the given
+// algorithm:
+// https://github.com/boto/botocore/blob/69618a93752834ca99e52977058b5ee176df7007/botocore/credentials.py#L760-L780
+// Additional json formatting is done to mimic the Python json format
+func (k Key) Hash(algorithm string) string {
+	// Marshalling a struct of strings and ints can't fail
+	blob, _ := json.Marshal(k)
+
+	blobStr := string(blob)
+	blobStr = strings.Replace(blobStr, `":`, `": `, -1)
+	blobStr = strings.Replace(blobStr, `,"`, `, "`, -1)
+	var h hash.Hash = sha1.New()
+	if algorithm == HashSHA256 {
+		h = sha256.New()
+	}
+	h.Write([]byte(blobStr))
+
+	return strings.ToLower(hex.EncodeToString(h.Sum(nil)))
+}
+
+// ToolNative reports whether the key has inputs that botocore never sets, so the
+// aws CLI could not have written (or read) the entry
+func (k Key) ToolNative() bool {
+	return k.IdentityPoolId != "" || k.MFASession || k.PolicyHash != "" || k.WrapCommand != ""
+}
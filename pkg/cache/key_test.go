@@ -0,0 +1,56 @@
+package cache
+
+import "testing"
+
+// The names must match those botocore gives the same inputs, computed with
+// json.dumps(key, sort_keys=True) so the aws CLI and this package share entries
+func TestKeyHash(t *testing.T) {
+	tests := []struct {
+		key          Key
+		sha1, sha256 string
+	}{
+		{
+			key:    Key{RoleArn: "arn:aws:iam::123456789012:role/Local"},
+			sha1:   "6e00fd000c2441080819ac7238b89f999b02ba3c",
+			sha256: "31c3d87522f8d34fdda7182111f391ba0474a3dc83d64d4be9f724a6e7bc7a36",
+		},
+		{
+			key: Key{
+				DurationSeconds: 3600,
+				RoleArn:         "arn:aws:iam::123456789012:role/Dev",
+				RoleSessionName: "me",
+				SerialNumber:    "arn:aws:iam::123456789012:mfa/me",
+			},
+			sha1:   "87bb7918c10c140280e3ceccc369d15906528d24",
+			sha256: "acb12bf505d7fe664e966e75f19c41a7d61f69a84f1f3ba711b9533290f2ec0e",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.key.String(); got != tt.sha1 {
+			t.Errorf("%+v.String() = %s, want %s", tt.key, got, tt.sha1)
+		}
+		if got := tt.key.Hash(HashSHA256); got != tt.sha256 {
+			t.Errorf("%+v.Hash(sha256) = %s, want %s", tt.key, got, tt.sha256)
+		}
+	}
+}
+
+func TestKeyToolNative(t *testing.T) {
+	tests := []struct {
+		name string
+		key  Key
+		want bool
+	}{
+		{"assumed role", Key{RoleArn: "arn:aws:iam::123456789012:role/Dev", SerialNumber: "arn:aws:iam::123456789012:mfa/me"}, false},
+		{"sso", Key{AccountId: "123456789012", RoleName: "Admin", StartUrl: "https://example.awsapps.com/start"}, false},
+		{"cognito", Key{IdentityPoolId: "us-east-1:pool"}, true},
+		{"session policy", Key{RoleArn: "arn:aws:iam::123456789012:role/Dev", PolicyHash: PolicyHash(`{}`)}, true},
+		{"wrapped command", Key{WrapCommand: "other-tool"}, true},
+		{"mfa session", Key{DurationSeconds: 43200, MFASession: true, SerialNumber: "arn:aws:iam::123456789012:mfa/me"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.key.ToolNative(); got != tt.want {
+			t.Errorf("%s: ToolNative() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// DefaultExpiryWindow is how long before they expire cached credentials are refreshed,
+// unless Options.ExpiryWindow is set
+const DefaultExpiryWindow = 5 * time.Minute
+
+// Options configure a Provider
+type Options struct {
+	// Backend stores the entries, FileBackend{} (the aws CLI's cache) if nil
+	Backend Backend
+	// KeyHash is the algorithm the entry's name is hashed with, HashSHA1 if empty,
+	// as the aws CLI does. Entries named with the other one are migrated
+	KeyHash string
+	// ExpiryWindow is how long before they expire the cached credentials are refreshed
+	ExpiryWindow time.Duration
+	// ForceRefresh always retrieves new credentials, replacing the cached ones
+	ForceRefresh bool
+	// MaxRefreshes limits how many retrieves run at once. Zero means no limit
+	MaxRefreshes int
+	// AcquireSlot limits the refreshes for backends that don't implement Slotter, e.g.
+	// with lock files. Without it, MaxRefreshes only applies to Slotter backends
+	AcquireSlot func(ctx context.Context, name string, slots int) (func(), error)
+	// Encryption encrypts the entries, if set
+	Encryption *Encryption
+	// Logf logs warnings, like a corrupt entry being removed
+	Logf func(format string, v ...any)
+}
+
+// Encryption encrypts entries at rest. Encrypted entries get their own Extension, so
+// the aws CLI never tries to read them
+type Encryption struct {
+	Extension string
+	Seal      func(data []byte) ([]byte, error)
+	Open      func(data []byte) ([]byte, error)
+}
+
+// Provider is an aws.CredentialsProvider that returns the credentials cached under its
+// key, retrieving them from the wrapped provider and caching them when they're missing
+// or about to expire
+type Provider struct {
+	provider aws.CredentialsProvider
+	key      Key
+	options  Options
+}
+
+var _ aws.CredentialsProvider = (*Provider)(nil)
+
+// New returns a Provider caching the credentials provider retrieves under key
+func New(provider aws.CredentialsProvider, key Key, optFns ...func(*Options)) *Provider {
+	options := Options{
+		Backend:      FileBackend{},
+		KeyHash:      HashSHA1,
+		ExpiryWindow: DefaultExpiryWindow,
+	}
+	for _, fn := range optFns {
+		fn(&options)
+	}
+	if options.Backend == nil {
+		options.Backend = FileBackend{}
+	}
+	if options.KeyHash == "" {
+		options.KeyHash = HashSHA1
+	}
+	return &Provider{provider: provider, key: key, options: options}
+}
+
+// Backend is where the entry is kept
+func (p *Provider) Backend() Backend {
+	return p.options.Backend
+}
+
+// toolNative reports whether the entry is one the aws CLI never reads, either encrypted
+// or with a key botocore never computes
+func (p *Provider) toolNative() bool {
+	return p.options.Encryption != nil || p.key.ToolNative()
+}
+
+func (p *Provider) extension() string {
+	if p.options.Encryption != nil {
+		return p.options.Encryption.Extension
+	}
+	return ".json"
+}
+
+// name is the entry's name with the key hashed with hash, namespaced by the schema
+// version unless it's 0
+func (p *Provider) name(hash string, version int) string {
+	name := p.key.Hash(hash)
+	if version > 0 {
+		name += fmt.Sprintf(".v%d", version)
+	}
+	return name + p.extension()
+}
+
+// Name is the name of the entry in the Backend. Tool-native entries are namespaced by
+// schema version, so binaries on either side of a breaking schema change can't clobber
+// each other. Others keep the name the aws CLI gives them
+func (p *Provider) Name() string {
+	if p.toolNative() {
+		return p.name(p.options.KeyHash, SchemaVersion)
+	}
+	return p.name(p.options.KeyHash, 0)
+}
+
+// LegacyNames returns the names the entry may have been written under before: with the
+// other KeyHash, then for tool-native entries by older schema versions, newest first
+func (p *Provider) LegacyNames() []string {
+	other := HashSHA256
+	if p.options.KeyHash == HashSHA256 {
+		other = HashSHA1
+	}
+	if !p.toolNative() {
+		return []string{p.name(other, 0)}
+	}
+	names := []string{p.name(other, SchemaVersion)}
+	// Schema version 0 entries were not namespaced
+	for v := SchemaVersion - 1; v >= 0; v-- {
+		names = append(names, p.name(p.options.KeyHash, v))
+	}
+	return names
+}
+
+// Location describes where the entry is kept, e.g. the path of its file
+func (p *Provider) Location() string {
+	return p.options.Backend.Location(p.Name())
+}
+
+// Retrieve returns the cached credentials unless they expire within the ExpiryWindow,
+// otherwise the wrapped provider's, which are cached
+func (p *Provider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	if !p.options.ForceRefresh {
+		if creds, err := p.Get(); err == nil && !p.RefreshDue(creds) {
+			return creds, nil
+		}
+	}
+	creds, _, err := p.Refresh(ctx)
+	return creds, err
+}
+
+// RefreshDue reports whether creds expire within the ExpiryWindow
+func (p *Provider) RefreshDue(creds aws.Credentials) bool {
+	return creds.CanExpire && time.Until(creds.Expires) < p.options.ExpiryWindow
+}
+
+// Refresh retrieves new credentials from the wrapped provider and caches them. With
+// MaxRefreshes, it first waits for a slot, and if another caller cached credentials
+// while it waited, returns those instead and reports that they came from the cache.
+// Even with ForceRefresh, those are as fresh as the ones it would get itself, so a
+// burst of forced refreshes only retrieves once
+func (p *Provider) Refresh(ctx context.Context) (aws.Credentials, bool, error) {
+	acquire := p.options.AcquireSlot
+	if slotter, ok := p.options.Backend.(Slotter); ok {
+		acquire = slotter.AcquireSlot
+	}
+	if p.options.MaxRefreshes > 0 && acquire != nil {
+		waitStart := time.Now()
+		release, err := acquire(ctx, "refresh-"+p.key.Hash(p.options.KeyHash), p.options.MaxRefreshes)
+		if err != nil {
+			return aws.Credentials{}, false, err
+		}
+		defer release()
+
+		if !p.options.ForceRefresh || p.writtenSince(waitStart) {
+			if creds, err := p.Get(); err == nil && !p.RefreshDue(creds) {
+				return creds, true, nil
+			}
+		}
+	}
+
+	creds, err := p.provider.Retrieve(ctx)
+	if err != nil {
+		return creds, false, err
+	}
+	if err := p.Put(creds); err != nil {
+		return creds, false, err
+	}
+	return creds, false, nil
+}
+
+// writtenSince reports whether the entry was written after t. Backends that don't record
+// when entries were written never report that they were
+func (p *Provider) writtenSince(t time.Time) bool {
+	backend, ok := p.options.Backend.(ModTimer)
+	if !ok {
+		return false
+	}
+	written, err := backend.ModTime(p.Name())
+	return err == nil && written.After(t)
+}
+
+// Get returns the cached credentials, expired or not, or an error wrapping
+// os.ErrNotExist if there are none. Entries that can't be decoded are removed, and
+// valid ones under a LegacyName are migrated to the Name
+func (p *Provider) Get() (aws.Credentials, error) {
+	creds, err := p.read(p.Name())
+	var corrupt *CorruptError
+	if errors.As(err, &corrupt) {
+		// Treat it as missing, so the credentials are refreshed and written anew rather than
+		// every tool reading the cache tripping over it until they are
+		p.logf("warning: removing corrupt cache entry %s, %v", p.Location(), err)
+		if err := p.Delete(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return creds, fmt.Errorf("failed to remove corrupt cache entry, %w", err)
+		}
+		err = os.ErrNotExist
+	}
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return creds, err
+	}
+	return p.migrate()
+}
+
+// migrate looks for a valid entry under one of the LegacyNames and saves it under the
+// Name, so neither upgrading nor switching the KeyHash forces a new session (and MFA
+// prompt). The old entry is left in place for any older binaries that are still in use
+func (p *Provider) migrate() (aws.Credentials, error) {
+	for _, legacy := range p.LegacyNames() {
+		creds, err := p.read(legacy)
+		if err != nil || creds.Expired() {
+			continue
+		}
+		if err := p.Put(creds); err != nil {
+			return creds, err
+		}
+		return creds, nil
+	}
+	return aws.Credentials{}, fmt.Errorf("cache file does not exist, %w", os.ErrNotExist)
+}
+
+// Decode decodes an entry of this Provider's backend, decrypting it if need be
+func (p *Provider) Decode(data []byte) (*Item, error) {
+	if p.options.Encryption != nil {
+		var err error
+		if data, err = p.options.Encryption.Open(data); err != nil {
+			return nil, err
+		}
+	}
+	return Decode(data)
+}
+
+func (p *Provider) read(name string) (aws.Credentials, error) {
+	data, err := p.options.Backend.Get(name)
+	if err != nil {
+		return aws.Credentials{CanExpire: true}, fmt.Errorf("failed to read cache entry, %w", err)
+	}
+	item, err := p.Decode(data)
+	if err != nil {
+		return aws.Credentials{CanExpire: true}, err
+	}
+	if err := item.Upgrade(); err != nil {
+		return aws.Credentials{CanExpire: true}, err
+	}
+	return item.AWSCredentials(), nil
+}
+
+// Put caches creds, replacing any cached credentials. Tool-native entries are tagged
+// with the schema version and record their key
+func (p *Provider) Put(creds aws.Credentials) error {
+	item := NewItem(creds)
+	if p.toolNative() {
+		key := p.key
+		item.SchemaVersion = SchemaVersion
+		item.Key = &key
+	}
+	data, err := item.Encode()
+	if err != nil {
+		return err
+	}
+	if p.options.Encryption != nil {
+		if data, err = p.options.Encryption.Seal(data); err != nil {
+			return err
+		}
+	}
+	if err := p.options.Backend.Put(p.Name(), data); err != nil {
+		return fmt.Errorf("failed to write cache entry, %w", err)
+	}
+	return nil
+}
+
+// Delete removes the entry, returning an error wrapping os.ErrNotExist if there is none
+func (p *Provider) Delete() error {
+	return p.options.Backend.Delete(p.Name())
+}
+
+func (p *Provider) logf(format string, v ...any) {
+	if p.options.Logf != nil {
+		p.options.Logf(format, v...)
+	}
+}
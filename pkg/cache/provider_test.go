@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// stubProvider returns credentials valid for an hour, counting the calls
+type stubProvider struct {
+	calls atomic.Int32
+	delay time.Duration
+}
+
+func (p *stubProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	p.calls.Add(1)
+	time.Sleep(p.delay)
+	return aws.Credentials{
+		AccessKeyID:     "ASIANEW",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		CanExpire:       true,
+		Expires:         time.Now().Add(time.Hour).Truncate(time.Second),
+	}, nil
+}
+
+var testKey = Key{RoleArn: "arn:aws:iam::123456789012:role/Dev"}
+
+func TestProviderNames(t *testing.T) {
+	encryption := &Encryption{
+		Extension: ".test",
+		Seal:      func(data []byte) ([]byte, error) { return bytes.ToUpper(data), nil },
+		Open:      func(data []byte) ([]byte, error) { return bytes.ToLower(data), nil },
+	}
+	sha1Name, sha256Name := testKey.Hash(HashSHA1), testKey.Hash(HashSHA256)
+	tests := []struct {
+		name   string
+		key    Key
+		opts   Options
+		want   string
+		legacy []string
+	}{
+		{
+			name:   "aws CLI entry",
+			key:    testKey,
+			want:   sha1Name + ".json",
+			legacy: []string{sha256Name + ".json"},
+		},
+		{
+			name:   "sha256",
+			key:    testKey,
+			opts:   Options{KeyHash: HashSHA256},
+			want:   sha256Name + ".json",
+			legacy: []string{sha1Name + ".json"},
+		},
+		{
+			name:   "encrypted",
+			key:    testKey,
+			opts:   Options{Encryption: encryption},
+			want:   sha1Name + ".v1.test",
+			legacy: []string{sha256Name + ".v1.test", sha1Name + ".test"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(&stubProvider{}, tt.key, func(o *Options) {
+				o.Backend = NewMemoryBackend()
+				if tt.opts.KeyHash != "" {
+					o.KeyHash = tt.opts.KeyHash
+				}
+				o.Encryption = tt.opts.Encryption
+			})
+			if got := p.Name(); got != tt.want {
+				t.Errorf("Name() = %s, want %s", got, tt.want)
+			}
+			if got := p.LegacyNames(); strings.Join(got, " ") != strings.Join(tt.legacy, " ") {
+				t.Errorf("LegacyNames() = %v, want %v", got, tt.legacy)
+			}
+		})
+	}
+}
+
+func TestProviderEncryption(t *testing.T) {
+	backend := NewMemoryBackend()
+	p := New(&stubProvider{}, testKey, func(o *Options) {
+		o.Backend = backend
+		o.Encryption = &Encryption{
+			Extension: ".test",
+			Seal:      func(data []byte) ([]byte, error) { return append([]byte("sealed:"), data...), nil },
+			Open: func(data []byte) ([]byte, error) {
+				opened, ok := bytes.CutPrefix(data, []byte("sealed:"))
+				if !ok {
+					return nil, errors.New("not sealed")
+				}
+				return opened, nil
+			},
+		}
+	})
+	if _, err := p.Retrieve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := backend.Get(p.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("sealed:")) {
+		t.Errorf("entry was written unencrypted: %s", data)
+	}
+	creds, err := p.Get()
+	if err != nil || creds.AccessKeyID != "ASIANEW" {
+		t.Errorf("Get() = %s, %v, want the cached ASIANEW", creds.AccessKeyID, err)
+	}
+}
+
+func TestProviderRetrieve(t *testing.T) {
+	stub := &stubProvider{}
+	p := New(stub, testKey, func(o *Options) { o.Backend = NewMemoryBackend() })
+	for i := 0; i < 3; i++ {
+		if _, err := p.Retrieve(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := stub.calls.Load(); calls != 1 {
+		t.Errorf("retrieved %d times, want 1", calls)
+	}
+
+	// Credentials due to be refreshed are replaced
+	expiring := NewItem(aws.Credentials{AccessKeyID: "ASIAOLD", Expires: time.Now().Add(time.Minute)})
+	data, _ := expiring.Encode()
+	p.Backend().Put(p.Name(), data)
+	creds, err := p.Retrieve(context.Background())
+	if err != nil || creds.AccessKeyID != "ASIANEW" || stub.calls.Load() != 2 {
+		t.Errorf("Retrieve() = %s, %v after %d calls, want a refresh", creds.AccessKeyID, err, stub.calls.Load())
+	}
+}
+
+func TestProviderRemovesCorruptEntries(t *testing.T) {
+	var warnings []string
+	p := New(&stubProvider{}, testKey, func(o *Options) {
+		o.Backend = NewMemoryBackend()
+		o.Logf = func(format string, v ...any) { warnings = append(warnings, format) }
+	})
+	p.Backend().Put(p.Name(), []byte(`{"Credentials": {"AccessKeyId": "ASIA`))
+
+	if _, err := p.Get(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get() of a corrupt entry = %v, want os.ErrNotExist", err)
+	}
+	if _, err := p.Backend().Get(p.Name()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("corrupt entry was not removed, %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("logged %d warnings, want 1", len(warnings))
+	}
+}
+
+func TestProviderNewerSchema(t *testing.T) {
+	p := New(&stubProvider{}, Key{WrapCommand: "other-tool"}, func(o *Options) { o.Backend = NewMemoryBackend() })
+	item := NewItem(aws.Credentials{AccessKeyID: "ASIA", Expires: time.Now().Add(time.Hour)})
+	item.SchemaVersion = SchemaVersion + 1
+	data, _ := item.Encode()
+	p.Backend().Put(p.Name(), data)
+	if _, err := p.Get(); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get() of a newer schema version = %v, want an error", err)
+	}
+}
+
+// Callers that wait for a refresh slot use the credentials the caller holding it cached
+func TestProviderRefreshSlots(t *testing.T) {
+	stub := &stubProvider{delay: 50 * time.Millisecond}
+	backend := NewMemoryBackend()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := New(stub, testKey, func(o *Options) {
+				o.Backend = backend
+				o.MaxRefreshes = 1
+			})
+			if _, err := p.Retrieve(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls := stub.calls.Load(); calls != 1 {
+		t.Errorf("retrieved %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,112 @@
+// Package mfa provides token providers that read the MFA code for an AssumeRole call,
+// for stscreds.AssumeRoleOptions.TokenProvider
+package mfa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-tty"
+	"github.com/ryandeivert/aws-cred-proc/internal/shell"
+)
+
+var codePattern = regexp.MustCompile(`^\d{6}$`)
+
+// ValidCode reports whether code is a 6 digit MFA code
+func ValidCode(code string) bool {
+	return codePattern.MatchString(code)
+}
+
+// Command runs an external command that prints an MFA code to stdout
+func Command(name string, args ...string) (string, error) {
+	return RunCommand(exec.Command(name, args...))
+}
+
+// RunCommand is Command for a command that needs more set up, like its environment
+func RunCommand(cmd *exec.Cmd) (string, error) {
+	name := cmd.Args[0]
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed, %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	code := strings.TrimSpace(string(out))
+	if !ValidCode(code) {
+		return "", fmt.Errorf("%s did not return a 6 digit MFA code", name)
+	}
+	return code, nil
+}
+
+// Process returns a token provider that runs command, which prints the MFA code to
+// stdout, with the shell the same as credential_process. Like credential_process
+// helpers it can prompt on the terminal. env is added to its environment
+func Process(command string, env ...string) func() (string, error) {
+	return func() (string, error) {
+		if strings.TrimSpace(command) == "" {
+			return "", fmt.Errorf("the MFA command is empty")
+		}
+		cmd := shell.Command(context.Background(), command)
+		cmd.Env = append(cmd.Environ(), env...)
+		cmd.Stdin, cmd.Stderr = os.Stdin, os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("the MFA command failed, %w", err)
+		}
+
+		code := strings.TrimSpace(string(out))
+		if !ValidCode(code) {
+			return "", fmt.Errorf("the MFA command did not print a 6 digit MFA code")
+		}
+		return code, nil
+	}
+}
+
+// OnePassword returns a token provider that reads the current one-time password for an
+// item using the 1Password CLI
+func OnePassword(item string) func() (string, error) {
+	return func() (string, error) {
+		return Command("op", "item", "get", item, "--otp")
+	}
+}
+
+// Pass returns a token provider that reads the current one-time password for an entry
+// in the standard Unix password store using the pass-otp extension, or the gopass
+// equivalent
+func Pass(command, entry string) func() (string, error) {
+	return func() (string, error) {
+		switch command {
+		case "pass":
+			return Command("pass", "otp", entry)
+		case "gopass":
+			// -o prints only the code, without the remaining validity
+			return Command("gopass", "otp", "-o", entry)
+		default:
+			return "", fmt.Errorf("unsupported password store command %q, expected pass or gopass", command)
+		}
+	}
+}
+
+// Prompt reads the MFA code from the terminal, so it isn't mixed up with the output
+// of a process whose stdin and stdout are redirected
+func Prompt() (string, error) {
+	tty, err := tty.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open tty, %w", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty.Output(), "MFA Code: ")
+
+	text, err := tty.ReadString()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
@@ -0,0 +1,88 @@
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+)
+
+// The encoding of the YubiKey OATH application, see
+// https://developers.yubico.com/OATH/YKOATH_Protocol.html. Talking to the key itself
+// needs PC/SC, so it's left to the command
+
+// OATHKey derives the key used to unlock the OATH application from its password, using
+// the device id from the SELECT response as the salt
+func OATHKey(password string, deviceID []byte) []byte {
+	return pbkdf2SHA1([]byte(password), deviceID, 1000, 16)
+}
+
+// pbkdf2SHA1 is PBKDF2 (RFC 8018) with HMAC-SHA1, for a key no longer than one block
+func pbkdf2SHA1(password, salt []byte, iterations, keyLen int) []byte {
+	mac := hmac.New(sha1.New, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key[:keyLen]
+}
+
+// TLVField is a BER-TLV field with a single byte tag
+type TLVField struct {
+	Tag   byte
+	Value []byte
+}
+
+// EncodeTLV encodes a field, with a long form length for values of 128 bytes or more
+func EncodeTLV(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	switch {
+	case len(value) < 0x80:
+		out = append(out, byte(len(value)))
+	case len(value) <= 0xff:
+		out = append(out, 0x81, byte(len(value)))
+	default:
+		out = append(out, 0x82, byte(len(value)>>8), byte(len(value)))
+	}
+	return append(out, value...)
+}
+
+// ParseTLV decodes a sequence of fields, stopping at the first malformed field
+func ParseTLV(data []byte) []TLVField {
+	var fields []TLVField
+	for len(data) >= 2 {
+		tag, length, rest := data[0], int(data[1]), data[2:]
+		switch {
+		case length == 0x81 && len(rest) >= 1:
+			length, rest = int(rest[0]), rest[1:]
+		case length == 0x82 && len(rest) >= 2:
+			length, rest = int(binary.BigEndian.Uint16(rest)), rest[2:]
+		}
+		if length > len(rest) {
+			break
+		}
+		fields = append(fields, TLVField{Tag: tag, Value: rest[:length]})
+		data = rest[length:]
+	}
+	return fields
+}
+
+// TruncatedCode formats a truncated CALCULATE response, which is the number of digits
+// followed by the 4 byte code
+func TruncatedCode(value []byte) (string, error) {
+	if len(value) != 5 {
+		return "", fmt.Errorf("unexpected code length from YubiKey")
+	}
+	digits := int(value[0])
+	code := uint64(binary.BigEndian.Uint32(value[1:]) & 0x7fffffff)
+	return fmt.Sprintf("%0*d", digits, code%pow10(digits)), nil
+}
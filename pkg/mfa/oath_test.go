@@ -0,0 +1,123 @@
+package mfa
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// RFC 6070
+func TestPBKDF2SHA1(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		want           string
+	}{
+		{"password", "salt", 1, 20, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"password", "salt", 2, 20, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"password", "salt", 4096, 20, "4b007901b765489abead49d926f721d065a429c1"},
+		{"pass\x00word", "sa\x00lt", 4096, 16, "56fa6aa75548099dcc37d7f03425e0c3"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA1([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen))
+		if got != tt.want {
+			t.Errorf("pbkdf2SHA1(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestOATHKey(t *testing.T) {
+	deviceID := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	key := OATHKey("password", deviceID)
+	if len(key) != 16 {
+		t.Fatalf("OATHKey is %d bytes, want 16", len(key))
+	}
+	if want := pbkdf2SHA1([]byte("password"), deviceID, 1000, 16); !bytes.Equal(key, want) {
+		t.Errorf("OATHKey = %x, want %x", key, want)
+	}
+}
+
+func TestTLVRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		header []byte
+	}{
+		{"empty", 0, []byte{0x71, 0x00}},
+		{"short", 8, []byte{0x71, 0x08}},
+		{"longest short form", 0x7f, []byte{0x71, 0x7f}},
+		{"one byte long form", 0x80, []byte{0x71, 0x81, 0x80}},
+		{"longest one byte long form", 0xff, []byte{0x71, 0x81, 0xff}},
+		{"two byte long form", 0x100, []byte{0x71, 0x82, 0x01, 0x00}},
+		{"large", 0x1234, []byte{0x71, 0x82, 0x12, 0x34}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := bytes.Repeat([]byte{0xab}, tt.length)
+			encoded := EncodeTLV(0x71, value)
+			if !bytes.HasPrefix(encoded, tt.header) || len(encoded) != len(tt.header)+tt.length {
+				t.Fatalf("EncodeTLV header = %x, want %x", encoded[:min(len(encoded), len(tt.header))], tt.header)
+			}
+
+			// Followed by another field, to check the length consumed
+			fields := ParseTLV(append(encoded, EncodeTLV(0x74, []byte{1, 2})...))
+			want := []TLVField{{Tag: 0x71, Value: value}, {Tag: 0x74, Value: []byte{1, 2}}}
+			if len(fields) != 2 || fields[0].Tag != want[0].Tag || !bytes.Equal(fields[0].Value, want[0].Value) || !reflect.DeepEqual(fields[1], want[1]) {
+				t.Errorf("ParseTLV did not return the encoded fields, got %d fields", len(fields))
+			}
+		})
+	}
+}
+
+func TestParseTLVMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []TLVField
+	}{
+		{"empty", nil, nil},
+		{"tag only", []byte{0x71}, nil},
+		{"value shorter than length", []byte{0x71, 0x05, 0x01}, nil},
+		{"missing long form length", []byte{0x71, 0x82, 0x01}, nil},
+		{"stops at the malformed field", []byte{0x71, 0x01, 0xaa, 0x74, 0x09, 0x01}, []TLVField{{Tag: 0x71, Value: []byte{0xaa}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseTLV(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTLV(%x) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+// The truncated responses are the dynamic truncation of the RFC 4226 test vectors,
+// prefixed with the number of digits as the YubiKey returns them
+func TestTruncatedCode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"06cc93cf18", "755224", false}, // the top bit is masked off
+		{"064c93cf18", "755224", false},
+		{"06c1397eea", "287082", false},
+		{"08082fef30", "37359152", false},
+		{"064c93cf", "", true},
+		{"064c93cf1800", "", true},
+	}
+	for _, tt := range tests {
+		value, _ := hex.DecodeString(tt.value)
+		got, err := TruncatedCode(value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("TruncatedCode(%s) = %s, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("TruncatedCode(%s) = %s, %v, want %s", tt.value, got, err, tt.want)
+		}
+	}
+}
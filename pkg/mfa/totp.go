@@ -0,0 +1,76 @@
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Period is the TOTP time step of IAM virtual MFA devices
+const Period = 30 * time.Second
+
+// DecodeSeed accepts the base32 secret as displayed by the IAM console, ignoring case,
+// whitespace and padding
+func DecodeSeed(seed string) ([]byte, error) {
+	seed = strings.ToUpper(strings.Join(strings.Fields(seed), ""))
+	seed = strings.TrimRight(seed, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(seed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base32 TOTP seed, %w", err)
+	}
+	return key, nil
+}
+
+// HOTP computes an RFC 4226 code with HMAC-SHA1 and the given number of digits
+func HOTP(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+	return fmt.Sprintf("%0*d", digits, value%pow10(digits))
+}
+
+// TOTP computes an RFC 6238 code using the parameters IAM virtual MFA devices use:
+// HMAC-SHA1, 30 second steps and 6 digits
+func TOTP(key []byte, t time.Time) string {
+	return HOTP(key, timeStep(t), 6)
+}
+
+// TOTPChallenge is the TOTP time step counter for t, as the 8 bytes HMAC is computed over
+func TOTPChallenge(t time.Time) []byte {
+	challenge := make([]byte, 8)
+	binary.BigEndian.PutUint64(challenge, timeStep(t))
+	return challenge
+}
+
+// TOTPSeed returns a token provider that computes the MFA code from a base32 seed
+func TOTPSeed(seed string) func() (string, error) {
+	return func() (string, error) {
+		key, err := DecodeSeed(seed)
+		if err != nil {
+			return "", err
+		}
+		return TOTP(key, time.Now()), nil
+	}
+}
+
+func timeStep(t time.Time) uint64 {
+	return uint64(t.Unix() / int64(Period.Seconds()))
+}
+
+func pow10(n int) uint64 {
+	v := uint64(1)
+	for i := 0; i < n; i++ {
+		v *= 10
+	}
+	return v
+}
@@ -0,0 +1,103 @@
+package mfa
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the HMAC-SHA1 secret of the RFC 4226 and RFC 6238 test vectors
+var rfcSecret = []byte("12345678901234567890")
+
+// RFC 4226 appendix D
+func TestHOTP(t *testing.T) {
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	for counter, code := range want {
+		if got := HOTP(rfcSecret, uint64(counter), 6); got != code {
+			t.Errorf("HOTP(counter %d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// RFC 6238 appendix B, the SHA1 rows
+var totpVectors = []struct {
+	unix      int64
+	challenge string
+	code      string
+}{
+	{59, "0000000000000001", "94287082"},
+	{1111111109, "00000000023523ec", "07081804"},
+	{1111111111, "00000000023523ed", "14050471"},
+	{1234567890, "000000000273ef07", "89005924"},
+	{2000000000, "0000000003f940aa", "69279037"},
+	{20000000000, "0000000027bc86aa", "65353130"},
+}
+
+func TestTOTP(t *testing.T) {
+	for _, tt := range totpVectors {
+		at := time.Unix(tt.unix, 0)
+		if got := HOTP(rfcSecret, timeStep(at), 8); got != tt.code {
+			t.Errorf("8 digit TOTP at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+		// IAM devices use 6 digits, the low digits of the same value
+		if got, want := TOTP(rfcSecret, at), tt.code[2:]; got != want {
+			t.Errorf("TOTP at %d = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+// The YubiKey computes the code from the challenge, so it must be the RFC 6238 time step
+func TestTOTPChallenge(t *testing.T) {
+	for _, tt := range totpVectors {
+		if got := hex.EncodeToString(TOTPChallenge(time.Unix(tt.unix, 0))); got != tt.challenge {
+			t.Errorf("TOTPChallenge(%d) = %s, want %s", tt.unix, got, tt.challenge)
+		}
+	}
+}
+
+func TestDecodeSeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		seed    string
+		wantErr bool
+	}{
+		{"console format", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", false},
+		{"lower case", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", false},
+		{"grouped with spaces", "GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ", false},
+		{"padded", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ====", false},
+		{"not base32", "GEZDGNBVGY3TQOJ1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := DecodeSeed(tt.seed)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("DecodeSeed(%q) = %q, want an error", tt.seed, key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(key) != string(rfcSecret) {
+				t.Errorf("DecodeSeed(%q) = %q, want %q", tt.seed, key, rfcSecret)
+			}
+		})
+	}
+}
+
+func TestTOTPSeed(t *testing.T) {
+	if _, err := TOTPSeed("not base32!")(); err == nil {
+		t.Error("TOTPSeed with an invalid seed did not return an error")
+	}
+	code, err := TOTPSeed("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ValidCode(code) {
+		t.Errorf("TOTPSeed returned %q, want a 6 digit code", code)
+	}
+}
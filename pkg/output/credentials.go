@@ -0,0 +1,93 @@
+package output
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/processcreds"
+)
+
+// ProcessCredentials adds the optional AccountId field of the credential_process
+// format, which the SDK's response type does not have in the version used here
+type ProcessCredentials struct {
+	processcreds.CredentialProcessResponse
+	AccountId string `json:",omitempty"`
+}
+
+func NewProcessCredentials(creds aws.Credentials) *ProcessCredentials {
+	return &ProcessCredentials{
+		CredentialProcessResponse: processcreds.CredentialProcessResponse{
+			Version:         1,
+			AccessKeyID:     creds.AccessKeyID,
+			SecretAccessKey: creds.SecretAccessKey,
+			SessionToken:    creds.SessionToken,
+			Expiration:      &creds.Expires,
+		},
+		AccountId: creds.AccountID,
+	}
+}
+
+// ShellCredentials are the environment variables the SDKs and tools read credentials from
+type ShellCredentials struct {
+	AWS_ACCESS_KEY_ID     string
+	AWS_SECRET_ACCESS_KEY string
+	AWS_SESSION_TOKEN     string
+
+	// Optional variables are left out when empty. Tools that consume exported
+	// credentials read these to detect a stale environment
+	AWS_SESSION_EXPIRATION    string `shell:"omitempty"`
+	AWS_CREDENTIAL_EXPIRATION string `shell:"omitempty"`
+	AWS_REGION                string `shell:"omitempty"`
+	AWS_DEFAULT_REGION        string `shell:"omitempty"`
+}
+
+func NewShellCredentials(creds aws.Credentials, region string) *ShellCredentials {
+	s := &ShellCredentials{
+		AWS_ACCESS_KEY_ID:     creds.AccessKeyID,
+		AWS_SECRET_ACCESS_KEY: creds.SecretAccessKey,
+		AWS_SESSION_TOKEN:     creds.SessionToken,
+		AWS_REGION:            region,
+		AWS_DEFAULT_REGION:    region,
+	}
+	if creds.CanExpire {
+		expiration := creds.Expires.UTC().Format(time.RFC3339)
+		s.AWS_SESSION_EXPIRATION = expiration
+		s.AWS_CREDENTIAL_EXPIRATION = expiration
+	}
+	return s
+}
+
+// Lines formats each variable's name and value using line
+func (s *ShellCredentials) Lines(line func(name, value string) string) string {
+	ct := reflect.ValueOf(s).Elem()
+	typeOfC := ct.Type()
+
+	var lines []string
+	for i := 0; i < ct.NumField(); i++ {
+		f := ct.Field(i)
+		if f.IsZero() && typeOfC.Field(i).Tag.Get("shell") == "omitempty" {
+			continue
+		}
+		lines = append(lines, line(strings.ToUpper(typeOfC.Field(i).Name), fmt.Sprint(f)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Names returns the name of every variable, including the optional ones
+func (s *ShellCredentials) Names() []string {
+	typeOfC := reflect.TypeOf(s).Elem()
+	names := make([]string, typeOfC.NumField())
+	for i := range names {
+		names[i] = strings.ToUpper(typeOfC.Field(i).Name)
+	}
+	return names
+}
+
+func (s *ShellCredentials) String() string {
+	return s.Lines(func(name, value string) string {
+		return fmt.Sprintf("export %s=%s", name, value)
+	})
+}
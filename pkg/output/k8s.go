@@ -0,0 +1,104 @@
+package output
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const (
+	k8sTokenPrefix = "k8s-aws-v1."
+	// EKS accepts a token for 15 minutes after it is signed. The expiry given to
+	// kubectl is a little earlier so it never presents one that is about to expire
+	k8sTokenLifetime  = 14 * time.Minute
+	k8sDefaultVersion = "client.authentication.k8s.io/v1beta1"
+)
+
+// execCredential is the client.authentication.k8s.io ExecCredential kubectl reads from exec plugins
+type execCredential struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Status     execCredentialStatus `json:"status"`
+}
+
+type execCredentialStatus struct {
+	ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+	Token               string    `json:"token"`
+}
+
+// k8sAPIVersion answers with the version kubectl asked for in KUBERNETES_EXEC_INFO
+func k8sAPIVersion() string {
+	var info struct {
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal([]byte(os.Getenv("KUBERNETES_EXEC_INFO")), &info); err == nil && info.APIVersion != "" {
+		return info.APIVersion
+	}
+	return k8sDefaultVersion
+}
+
+// k8sToken presigns a GetCallerIdentity request bound to the cluster, the same token
+// aws-iam-authenticator and `aws eks get-token` produce
+func k8sToken(ctx context.Context, cluster string, creds aws.Credentials, region string, optFns ...func(*sts.Options)) (string, error) {
+	client := sts.New(sts.Options{
+		Credentials: credentials.StaticCredentialsProvider{Value: creds},
+		Region:      region,
+	}, optFns...)
+	presigned, err := sts.NewPresignClient(client).PresignGetCallerIdentity(ctx, &sts.GetCallerIdentityInput{},
+		sts.WithPresignClientFromClientOptions(sts.WithAPIOptions(
+			smithyhttp.SetHeaderValue("x-k8s-aws-id", cluster),
+			smithyhttp.SetHeaderValue("X-Amz-Expires", "60"),
+		)),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign GetCallerIdentity, %w", err)
+	}
+	return k8sTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presigned.URL)), nil
+}
+
+// k8sExecOutput writes an ExecCredential, so it can be used by a kubectl exec
+// credential plugin
+func k8sExecOutput(opts Options) (Output, error) {
+	if opts.K8sCluster == "" {
+		return nil, fmt.Errorf("the k8s-exec output requires a cluster")
+	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Func(func(w io.Writer, creds aws.Credentials, region string) error {
+		return writeK8sExec(ctx, w, opts.K8sCluster, creds, region, opts.STSOptions...)
+	}), nil
+}
+
+func writeK8sExec(ctx context.Context, w io.Writer, cluster string, creds aws.Credentials, region string, optFns ...func(*sts.Options)) error {
+	token, err := k8sToken(ctx, cluster, creds, region, optFns...)
+	if err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(k8sTokenLifetime)
+	if creds.CanExpire && creds.Expires.Before(expires) {
+		expires = creds.Expires
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&execCredential{
+		APIVersion: k8sAPIVersion(),
+		Kind:       "ExecCredential",
+		Status: execCredentialStatus{
+			ExpirationTimestamp: expires.UTC().Truncate(time.Second),
+			Token:               token,
+		},
+	})
+}
@@ -0,0 +1,109 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// k8sTokenURL decodes the presigned URL in the ExecCredential w was written with
+func k8sTokenURL(t *testing.T, w *bytes.Buffer) *url.URL {
+	t.Helper()
+	var cred execCredential
+	if err := json.Unmarshal(w.Bytes(), &cred); err != nil {
+		t.Fatal(err)
+	}
+	encoded, ok := strings.CutPrefix(cred.Status.Token, k8sTokenPrefix)
+	if !ok {
+		t.Fatalf("token %q lacks the %s prefix", cred.Status.Token, k8sTokenPrefix)
+	}
+	presigned, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(string(presigned))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestK8sExecEndpoint(t *testing.T) {
+	creds := aws.Credentials{AccessKeyID: "ASIA", SecretAccessKey: "secret", SessionToken: "token"}
+	tests := []struct {
+		name     string
+		optFns   []func(*sts.Options)
+		region   string
+		wantHost string
+	}{
+		{name: "regional", region: "us-west-2", wantHost: "sts.us-west-2.amazonaws.com"},
+		{
+			name:     "fips",
+			region:   "us-east-1",
+			optFns:   []func(*sts.Options){func(o *sts.Options) { o.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateEnabled }},
+			wantHost: "sts-fips.us-east-1.amazonaws.com",
+		},
+		{
+			name:     "endpoint",
+			region:   "us-east-1",
+			optFns:   []func(*sts.Options){func(o *sts.Options) { o.BaseEndpoint = aws.String("https://sts.example.internal") }},
+			wantHost: "sts.example.internal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Lookup("k8s-exec", Options{K8sCluster: "dev", Context: context.Background(), STSOptions: tt.optFns})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var w bytes.Buffer
+			if err := out.Write(&w, creds, tt.region); err != nil {
+				t.Fatal(err)
+			}
+			u := k8sTokenURL(t, &w)
+			if u.Host != tt.wantHost {
+				t.Errorf("token is signed for %s, want %s", u.Host, tt.wantHost)
+			}
+			if got := u.Query().Get("X-Amz-SignedHeaders"); !strings.Contains(got, "x-k8s-aws-id") {
+				t.Errorf("token doesn't sign the cluster header, signed %q", got)
+			}
+		})
+	}
+}
+
+type k8sContextKey struct{}
+
+// The token is signed with the caller's context, not a new one
+func TestK8sExecContext(t *testing.T) {
+	var got any
+	capture := func(o *sts.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("capture",
+				func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+					got = ctx.Value(k8sContextKey{})
+					return next.HandleInitialize(ctx, in)
+				}), middleware.Before)
+		})
+	}
+	ctx := context.WithValue(context.Background(), k8sContextKey{}, "caller")
+	out, err := Lookup("k8s-exec", Options{K8sCluster: "dev", Context: ctx, STSOptions: []func(*sts.Options){capture}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := aws.Credentials{AccessKeyID: "ASIA", SecretAccessKey: "secret", CanExpire: true, Expires: time.Now().Add(time.Hour)}
+	if err := out.Write(&bytes.Buffer{}, creds, "us-east-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got != "caller" {
+		t.Errorf("token was signed with another context, its value is %v", got)
+	}
+}
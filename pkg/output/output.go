@@ -0,0 +1,203 @@
+// Package output writes credentials in the formats other tools read them in: the
+// credential_process JSON, shell variables, the shared credentials file and others
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Output writes credentials, for the region they were resolved for, in one format
+type Output interface {
+	Write(w io.Writer, creds aws.Credentials, region string) error
+}
+
+// Func adapts a function to the Output interface
+type Func func(w io.Writer, creds aws.Credentials, region string) error
+
+func (f Func) Write(w io.Writer, creds aws.Credentials, region string) error {
+	return f(w, creds, region)
+}
+
+// Options are the inputs some formats need besides the credentials
+type Options struct {
+	// Profile names the ini section, and is available to templates
+	Profile string
+	// Template is the text/template the template format executes
+	Template string
+	// K8sCluster is the EKS cluster the k8s-exec token is for
+	K8sCluster string
+	// Context is the context the k8s-exec token is signed with, context.Background() if nil
+	Context context.Context
+	// STSOptions configure the STS client the k8s-exec token is signed with, e.g. its
+	// endpoint, so the token is for the one the cluster's region verifies it against
+	STSOptions []func(*sts.Options)
+}
+
+// formats are the outputs Lookup returns by name
+var formats = map[string]func(Options) (Output, error){
+	"json":       static(writeProcessCredentials),
+	"env":        static(writeShellExports),
+	"env-unset":  static(writeShellUnset),
+	"powershell": static(writePowerShell),
+	"fish":       static(writeFish),
+	"cmd":        static(writeCmd),
+	"dotenv":     static(writeDotenv),
+	"ini":        iniOutput,
+	"template":   templateOutput,
+	"k8s-exec":   k8sExecOutput,
+}
+
+func static(f Func) func(Options) (Output, error) {
+	return func(Options) (Output, error) {
+		return f, nil
+	}
+}
+
+// Names returns the names of the formats, sorted
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the format with the name, or an error if there is none or opts lack
+// what it needs
+func Lookup(name string, opts Options) (Output, error) {
+	format, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output %q, expected one of: %s", name, strings.Join(Names(), ", "))
+	}
+	return format(opts)
+}
+
+// writeProcessCredentials writes the JSON the credential_process protocol expects
+func writeProcessCredentials(w io.Writer, creds aws.Credentials, _ string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(NewProcessCredentials(creds))
+}
+
+func writeShellExports(w io.Writer, creds aws.Credentials, region string) error {
+	_, err := fmt.Fprint(w, NewShellCredentials(creds, region))
+	return err
+}
+
+// writeShellUnset writes an unset command for the variables the env format exports.
+// The credentials are not used
+func writeShellUnset(w io.Writer, _ aws.Credentials, _ string) error {
+	names := (&ShellCredentials{}).Names()
+	_, err := fmt.Fprintf(w, "unset %s\n", strings.Join(names, " "))
+	return err
+}
+
+// powershellEscaper escapes the characters that are special inside a double quoted PowerShell string
+var powershellEscaper = strings.NewReplacer("`", "``", `"`, "`\"", "$", "`$")
+
+// writePowerShell writes $env: assignments, for use with Invoke-Expression
+func writePowerShell(w io.Writer, creds aws.Credentials, region string) error {
+	_, err := fmt.Fprint(w, NewShellCredentials(creds, region).Lines(func(name, value string) string {
+		return fmt.Sprintf(`$env:%s = "%s"`, name, powershellEscaper.Replace(value))
+	}))
+	return err
+}
+
+// fishEscaper escapes the characters that are special inside a single quoted fish string
+var fishEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// writeFish writes set -gx statements, for piping to source in fish
+func writeFish(w io.Writer, creds aws.Credentials, region string) error {
+	_, err := fmt.Fprint(w, NewShellCredentials(creds, region).Lines(func(name, value string) string {
+		return fmt.Sprintf("set -gx %s '%s'", name, fishEscaper.Replace(value))
+	}))
+	return err
+}
+
+// writeCmd writes SET commands for the Windows command prompt. The quoted form keeps
+// characters like & and ^ in the values from being interpreted
+func writeCmd(w io.Writer, creds aws.Credentials, region string) error {
+	_, err := fmt.Fprint(w, NewShellCredentials(creds, region).Lines(func(name, value string) string {
+		return fmt.Sprintf(`SET "%s=%s"`, name, value)
+	}))
+	return err
+}
+
+// writeDotenv writes KEY=value lines, without export, for tools that load .env files
+// like docker compose
+func writeDotenv(w io.Writer, creds aws.Credentials, region string) error {
+	_, err := fmt.Fprintln(w, NewShellCredentials(creds, region).Lines(func(name, value string) string {
+		return name + "=" + value
+	}))
+	return err
+}
+
+// iniOutput writes a section for the profile in the shared credentials file format
+func iniOutput(opts Options) (Output, error) {
+	section := opts.Profile
+	if section == "" {
+		section = "default"
+	}
+	return Func(func(w io.Writer, creds aws.Credentials, _ string) error {
+		lines := []string{
+			fmt.Sprintf("[%s]", section),
+			"aws_access_key_id = " + creds.AccessKeyID,
+			"aws_secret_access_key = " + creds.SecretAccessKey,
+		}
+		if creds.SessionToken != "" {
+			lines = append(lines, "aws_session_token = "+creds.SessionToken)
+		}
+		if creds.CanExpire {
+			lines = append(lines, "aws_session_expiration = "+creds.Expires.UTC().Format(time.RFC3339))
+		}
+		_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+		return err
+	}), nil
+}
+
+// TemplateData is what the template format's text is executed with. The credential
+// fields, like .AccessKeyID and .Expires, are promoted from aws.Credentials
+type TemplateData struct {
+	aws.Credentials
+	Region  string
+	Profile string
+}
+
+// ParseTemplate parses the text of the template format
+func ParseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, fmt.Errorf("the template output requires a template")
+	}
+	tmpl, err := template.New("output").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the template, %w", err)
+	}
+	return tmpl, nil
+}
+
+// templateOutput executes the template, e.g. to write credentials into another tool's
+// config file
+func templateOutput(opts Options) (Output, error) {
+	tmpl, err := ParseTemplate(opts.Template)
+	if err != nil {
+		return nil, err
+	}
+	return Func(func(w io.Writer, creds aws.Credentials, region string) error {
+		data := TemplateData{Credentials: creds, Region: region, Profile: opts.Profile}
+		if err := tmpl.Execute(w, data); err != nil {
+			return fmt.Errorf("failed to execute the template, %w", err)
+		}
+		return nil
+	}), nil
+}
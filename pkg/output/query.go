@@ -0,0 +1,116 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// queryStep is one field of a query path, optionally followed by array indexes
+type queryStep struct {
+	field   string
+	indexes []int
+}
+
+// parseQuery parses the subset of JMESPath that is useful against a single output
+// object: dotted field names, each optionally followed by [n] indexes, e.g.
+// status.expirationTimestamp or Credentials[0]. Negative indexes count from the end
+func parseQuery(query string) ([]queryStep, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("the query is empty")
+	}
+
+	var steps []queryStep
+	for _, part := range strings.Split(query, ".") {
+		field, rest, open := strings.Cut(strings.TrimSpace(part), "[")
+		step := queryStep{field: strings.Trim(field, `"`)}
+		if step.field == "" && len(steps) > 0 {
+			return nil, fmt.Errorf("invalid query %q, empty field name", query)
+		}
+		for open {
+			index, remaining, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid query %q, unclosed [", query)
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(index))
+			if err != nil {
+				return nil, fmt.Errorf("invalid query %q, index %q is not a number", query, index)
+			}
+			step.indexes = append(step.indexes, n)
+			if rest, open = strings.CutPrefix(remaining, "["); !open && rest != "" {
+				return nil, fmt.Errorf("invalid query %q, unexpected %q", query, rest)
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// evalQuery follows the steps through the decoded JSON. As with JMESPath, anything
+// that does not exist evaluates to null rather than an error
+func evalQuery(v any, steps []queryStep) any {
+	for _, step := range steps {
+		if step.field != "" {
+			object, ok := v.(map[string]any)
+			if !ok {
+				return nil
+			}
+			v = object[step.field]
+		}
+		for _, i := range step.indexes {
+			array, ok := v.([]any)
+			if !ok {
+				return nil
+			}
+			if i < 0 {
+				i += len(array)
+			}
+			if i < 0 || i >= len(array) {
+				return nil
+			}
+			v = array[i]
+		}
+	}
+	return v
+}
+
+// queryOutput writes only the part of a JSON output selected by a query. Strings are
+// written without quotes so shell scripts can use them directly
+type queryOutput struct {
+	Output
+	steps []queryStep
+}
+
+func (q queryOutput) Write(w io.Writer, creds aws.Credentials, region string) error {
+	var buf bytes.Buffer
+	if err := q.Output.Write(&buf, creds, region); err != nil {
+		return err
+	}
+	var v any
+	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+		return fmt.Errorf("the query requires an output format that writes JSON, %w", err)
+	}
+
+	result := evalQuery(v, q.steps)
+	if s, ok := result.(string); ok {
+		_, err := fmt.Fprintln(w, s)
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// Query returns an output writing only the part of out's JSON selected by query
+func Query(out Output, query string) (Output, error) {
+	steps, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return queryOutput{out, steps}, nil
+}
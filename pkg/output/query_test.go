@@ -0,0 +1,154 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []queryStep
+		wantErr bool
+	}{
+		{query: "Expiration", want: []queryStep{{field: "Expiration"}}},
+		{query: "status.expirationTimestamp", want: []queryStep{{field: "status"}, {field: "expirationTimestamp"}}},
+		{query: `"AccessKeyId"`, want: []queryStep{{field: "AccessKeyId"}}},
+		{query: "Items[0]", want: []queryStep{{field: "Items", indexes: []int{0}}}},
+		{query: "Items[-1].Name", want: []queryStep{{field: "Items", indexes: []int{-1}}, {field: "Name"}}},
+		{query: "Grid[1][ 2 ]", want: []queryStep{{field: "Grid", indexes: []int{1, 2}}}},
+		{query: "[0]", want: []queryStep{{indexes: []int{0}}}},
+		{query: "", wantErr: true},
+		{query: "  ", wantErr: true},
+		{query: "a..b", wantErr: true},
+		{query: "Items[0", wantErr: true},
+		{query: "Items[x]", wantErr: true},
+		{query: "Items[0]x", wantErr: true},
+		{query: "Items[", wantErr: true},
+		{query: "Items[0][", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseQuery(tt.query)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseQuery(%q) = %v, want an error", tt.query, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseQuery(%q) failed, %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestEvalQuery(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(`{"a": {"b": [10, {"c": "x"}, [1, 2]]}, "s": "str"}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  any
+	}{
+		{"s", "str"},
+		{"a.b[0]", 10.0},
+		{"a.b[1].c", "x"},
+		{"a.b[-1][0]", 1.0},
+		{"a.b[-3]", 10.0},
+		// As with JMESPath, anything missing is null
+		{"missing", nil},
+		{"a.b[3]", nil},
+		{"a.b[-4]", nil},
+		{"s.length", nil},
+		{"s[0]", nil},
+	}
+	for _, tt := range tests {
+		steps, err := parseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := evalQuery(doc, steps); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("evalQuery(%q) = %#v, want %#v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	creds := aws.Credentials{
+		AccessKeyID:     "ASIAEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		CanExpire:       true,
+		Expires:         time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		AccountID:       "123456789012",
+	}
+	json := Func(writeProcessCredentials)
+	tests := []struct {
+		name    string
+		out     Output
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{name: "strings are unquoted", out: json, query: "AccessKeyId", want: "ASIAEXAMPLE\n"},
+		{name: "expiration", out: json, query: "Expiration", want: "2030-01-02T03:04:05Z\n"},
+		{name: "numbers are json", out: json, query: "Version", want: "1\n"},
+		{name: "missing is null", out: json, query: "Nope", want: "null\n"},
+		{name: "not json", out: Func(writeShellExports), query: "AccessKeyId", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Query(tt.out, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			err = out.Write(&buf, creds, "us-east-1")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Write = %q, want an error", buf.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Write = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+
+	if _, err := Query(json, "a["); err == nil {
+		t.Error("Query with an invalid query did not return an error")
+	}
+}
+
+// The query is applied to the whole output, so an object is written as indented JSON
+func TestQueryObject(t *testing.T) {
+	out, err := Query(Func(func(w io.Writer, _ aws.Credentials, _ string) error {
+		_, err := io.WriteString(w, `{"status": {"token": "t", "expires": 5}}`)
+		return err
+	}), "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := out.Write(&buf, aws.Credentials{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"expires\": 5,\n  \"token\": \"t\"\n}\n"
+	if buf.String() != want {
+		t.Errorf("Write = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,109 @@
+// Package resolve resolves the credentials of a shared config profile the way the
+// aws-cred-proc command does, prompting for MFA and caching the assumed role session
+// where the aws CLI caches it, so programs embedding it share sessions with the aws CLI
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/ryandeivert/aws-cred-proc/pkg/cache"
+	"github.com/ryandeivert/aws-cred-proc/pkg/mfa"
+)
+
+// Options configure how a profile is resolved
+type Options struct {
+	// Profile is the shared config profile, AWS_PROFILE or default if empty
+	Profile string
+	// TokenProvider reads the MFA code for profiles with an mfa_serial, mfa.Prompt if nil
+	TokenProvider func() (string, error)
+	// Duration overrides the profile's duration_seconds
+	Duration time.Duration
+	// RoleSessionName overrides the profile's role_session_name
+	RoleSessionName string
+	// NoCache skips the cache, so every retrieve assumes the role
+	NoCache bool
+	// Cache configures the cache of the assumed role session
+	Cache []func(*cache.Options)
+}
+
+// Provider is an aws.CredentialsProvider for a profile
+type Provider struct {
+	credentials aws.CredentialsProvider
+	config      aws.Config
+}
+
+var _ aws.CredentialsProvider = (*Provider)(nil)
+
+// New loads the shared config profile. Profiles that assume a role get their session
+// from the cache, and only assume the role when it's missing or about to expire
+func New(ctx context.Context, optFns ...func(*Options)) (*Provider, error) {
+	var opts Options
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	if opts.TokenProvider == nil {
+		opts.TokenProvider = mfa.Prompt
+	}
+	// The SDK's in-memory cache has to let go of the credentials as soon as the file
+	// cache decides to refresh them
+	cacheOpts := cache.Options{ExpiryWindow: cache.DefaultExpiryWindow}
+	for _, fn := range opts.Cache {
+		fn(&cacheOpts)
+	}
+
+	// The options of the role the profile assumes, the last one constructed when roles
+	// are chained
+	var assumeRole *stscreds.AssumeRoleOptions
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithSharedConfigProfile(opts.Profile),
+		config.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) {
+			o.TokenProvider = opts.TokenProvider
+			if opts.Duration > 0 {
+				o.Duration = opts.Duration
+			}
+			if opts.RoleSessionName != "" {
+				o.RoleSessionName = opts.RoleSessionName
+			}
+			if o.RoleARN != "" {
+				captured := *o
+				assumeRole = &captured
+			}
+		}),
+		config.WithCredentialsCacheOptions(func(o *aws.CredentialsCacheOptions) {
+			o.ExpiryWindow = cacheOpts.ExpiryWindow
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the config of profile %q, %w", opts.Profile, err)
+	}
+
+	if assumeRole == nil || opts.NoCache {
+		return &Provider{credentials: cfg.Credentials, config: cfg}, nil
+	}
+	cached := cache.New(cfg.Credentials, cache.AssumeRoleKey(*assumeRole), opts.Cache...)
+	cfg.Credentials = aws.NewCredentialsCache(cached, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = cacheOpts.ExpiryWindow
+	})
+	return &Provider{credentials: cached, config: cfg}, nil
+}
+
+// Retrieve returns the profile's credentials
+func (p *Provider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	return p.credentials.Retrieve(ctx)
+}
+
+// Region is the profile's region, if it has one
+func (p *Provider) Region() string {
+	return p.config.Region
+}
+
+// Config is the profile's config with the Provider as its credentials, for creating
+// service clients
+func (p *Provider) Config() aws.Config {
+	return p.config.Copy()
+}